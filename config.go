@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"village-square/middleware"
+)
+
+// config holds the server settings. Each one can be set with a VS_*
+// environment variable or a command-line flag; flags win.
+type config struct {
+	Addr            string        // listen address
+	DBPath          string        // SQLite database file
+	StaticDir       string        // serve the frontend from here instead of the embedded copy
+	BaseURL         string        // public URL used in emailed links
+	SecureCookies   bool          // mark the session cookie Secure (HTTPS only)
+	SessionTTL      time.Duration // how long a login lasts after its last use
+	SessionMaxAge   time.Duration // how long a login lasts at most, however active
+	BodyLimit       int64         // maximum request body in bytes
+	ReportThreshold int           // open reports that auto-hide an item; 0 disables
+	ShutdownTimeout time.Duration // how long to wait for in-flight requests on shutdown
+	MetricsToken    string        // bearer token for /metrics; empty disables the endpoint
+	DeleteGrace     time.Duration // how long a deleted account can still be restored by logging in
+
+	TrustProxy       bool             // take client IPs and host from X-Forwarded-For and X-Forwarded-Host
+	RateLogin        middleware.Limit // login and password reset attempts, per IP and per email
+	RateSignup       middleware.Limit // registrations and emails sent, per IP
+	RateWrite        middleware.Limit // authenticated writes, per user
+	LockoutThreshold int              // failed logins in a row from one IP that lock an account for it; 0 disables
+	LockoutDuration  time.Duration    // how long a locked account stays locked
+
+	SMTPAddr     string // host:port of the SMTP server; empty uses the development mailer
+	SMTPFrom     string // sender address for outgoing mail
+	SMTPUser     string // SMTP username; empty skips authentication
+	SMTPPassword string // SMTP password
+	MailLog      string // file the development mailer appends to; empty prints to the log
+}
+
+// defaultConfig returns the settings used when nothing is configured.
+func defaultConfig() config {
+	return config{
+		Addr:            ":8080",
+		DBPath:          "village-square.db",
+		SessionTTL:      7 * 24 * time.Hour,
+		SessionMaxAge:   30 * 24 * time.Hour,
+		BodyLimit:       1 << 20, // 1 MB
+		ReportThreshold: 3,
+		ShutdownTimeout: 15 * time.Second,
+
+		RateLogin:        middleware.Limit{Requests: 10, Per: time.Minute},
+		RateSignup:       middleware.Limit{Requests: 10, Per: time.Hour},
+		RateWrite:        middleware.Limit{Requests: 60, Per: time.Minute},
+		LockoutThreshold: 5,
+		LockoutDuration:  15 * time.Minute,
+	}
+}
+
+// loadEnv overrides c with any VS_* environment variables that are set.
+func (c *config) loadEnv() error {
+	if v := os.Getenv("VS_ADDR"); v != "" {
+		c.Addr = v
+	}
+	if v := os.Getenv("VS_DB_PATH"); v != "" {
+		c.DBPath = v
+	}
+	if v := os.Getenv("VS_STATIC_DIR"); v != "" {
+		c.StaticDir = v
+	}
+	if v := os.Getenv("VS_BASE_URL"); v != "" {
+		c.BaseURL = v
+	}
+	if v := os.Getenv("VS_SECURE_COOKIES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_SECURE_COOKIES %q", v)
+		}
+		c.SecureCookies = b
+	}
+	if v := os.Getenv("VS_SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_SESSION_TTL %q", v)
+		}
+		c.SessionTTL = d
+	}
+	if v := os.Getenv("VS_SESSION_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_SESSION_MAX_AGE %q", v)
+		}
+		c.SessionMaxAge = d
+	}
+	if v := os.Getenv("VS_DELETE_GRACE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_DELETE_GRACE %q", v)
+		}
+		c.DeleteGrace = d
+	}
+	if v := os.Getenv("VS_BODY_LIMIT"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid VS_BODY_LIMIT %q", v)
+		}
+		c.BodyLimit = n
+	}
+	if v := os.Getenv("VS_REPORT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_REPORT_THRESHOLD %q", v)
+		}
+		c.ReportThreshold = n
+	}
+	if v := os.Getenv("VS_SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_SHUTDOWN_TIMEOUT %q", v)
+		}
+		c.ShutdownTimeout = d
+	}
+	if v := os.Getenv("VS_METRICS_TOKEN"); v != "" {
+		c.MetricsToken = v
+	}
+	if v := os.Getenv("VS_TRUST_PROXY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_TRUST_PROXY %q", v)
+		}
+		c.TrustProxy = b
+	}
+	for name, l := range map[string]*middleware.Limit{
+		"VS_RATE_LOGIN":  &c.RateLogin,
+		"VS_RATE_SIGNUP": &c.RateSignup,
+		"VS_RATE_WRITE":  &c.RateWrite,
+	} {
+		if v := os.Getenv(name); v != "" {
+			if err := l.Set(v); err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+	if v := os.Getenv("VS_LOCKOUT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_LOCKOUT_THRESHOLD %q", v)
+		}
+		c.LockoutThreshold = n
+	}
+	if v := os.Getenv("VS_LOCKOUT_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid VS_LOCKOUT_DURATION %q", v)
+		}
+		c.LockoutDuration = d
+	}
+	if v := os.Getenv("VS_SMTP_ADDR"); v != "" {
+		c.SMTPAddr = v
+	}
+	if v := os.Getenv("VS_SMTP_FROM"); v != "" {
+		c.SMTPFrom = v
+	}
+	if v := os.Getenv("VS_SMTP_USER"); v != "" {
+		c.SMTPUser = v
+	}
+	if v := os.Getenv("VS_SMTP_PASSWORD"); v != "" {
+		c.SMTPPassword = v
+	}
+	if v := os.Getenv("VS_MAIL_LOG"); v != "" {
+		c.MailLog = v
+	}
+	return nil
+}
+
+// registerFlags defines a flag for every setting, defaulting to the current
+// value so that flags override the environment.
+func (c *config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "Listen address (VS_ADDR)")
+	fs.StringVar(&c.DBPath, "db", c.DBPath, "SQLite database file (VS_DB_PATH)")
+	fs.StringVar(&c.StaticDir, "static", c.StaticDir, "Serve the frontend from this directory instead of the built-in copy, for development (VS_STATIC_DIR)")
+	fs.StringVar(&c.BaseURL, "base-url", c.BaseURL, "Public URL for links in emails; defaults to http://localhost<addr> (VS_BASE_URL)")
+	fs.BoolVar(&c.SecureCookies, "secure-cookies", c.SecureCookies, "Only send the session cookie over HTTPS (VS_SECURE_COOKIES)")
+	fs.DurationVar(&c.SessionTTL, "session-ttl", c.SessionTTL, "How long a login lasts after it was last used (VS_SESSION_TTL)")
+	fs.DurationVar(&c.SessionMaxAge, "session-max-age", c.SessionMaxAge, "How long a login lasts at most, even if used all along (VS_SESSION_MAX_AGE)")
+	fs.DurationVar(&c.DeleteGrace, "delete-grace", c.DeleteGrace, "How long a deleted account is kept, and can be restored by logging in, before it is removed; 0 deletes at once (VS_DELETE_GRACE)")
+	fs.Int64Var(&c.BodyLimit, "body-limit", c.BodyLimit, "Maximum request body size in bytes (VS_BODY_LIMIT)")
+	fs.IntVar(&c.ReportThreshold, "report-threshold", c.ReportThreshold, "Open reports that hide a post or event; 0 disables (VS_REPORT_THRESHOLD)")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "How long to let in-flight requests finish on shutdown (VS_SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&c.MetricsToken, "metrics-token", c.MetricsToken, "Bearer token that unlocks GET /metrics; the endpoint is off without one (VS_METRICS_TOKEN)")
+	fs.BoolVar(&c.TrustProxy, "trust-proxy", c.TrustProxy, "Take client IPs from X-Forwarded-For and the host from X-Forwarded-Host; only behind a reverse proxy (VS_TRUST_PROXY)")
+	fs.Var(&c.RateLogin, "rate-login", "Login attempts per IP and per email, e.g. 10/1m, or off (VS_RATE_LOGIN)")
+	fs.Var(&c.RateSignup, "rate-signup", "Registrations and emails sent per IP, e.g. 10/1h, or off (VS_RATE_SIGNUP)")
+	fs.Var(&c.RateWrite, "rate-write", "Writes per signed-in user, e.g. 60/1m, or off (VS_RATE_WRITE)")
+	fs.IntVar(&c.LockoutThreshold, "lockout-threshold", c.LockoutThreshold, "Failed logins in a row from one IP that lock an account for that IP; 0 disables (VS_LOCKOUT_THRESHOLD)")
+	fs.DurationVar(&c.LockoutDuration, "lockout-duration", c.LockoutDuration, "How long a locked account stays locked (VS_LOCKOUT_DURATION)")
+	fs.StringVar(&c.SMTPAddr, "smtp-addr", c.SMTPAddr, "SMTP server as host:port; without it mail goes to the mail log (VS_SMTP_ADDR)")
+	fs.StringVar(&c.SMTPFrom, "smtp-from", c.SMTPFrom, "Sender address for outgoing mail (VS_SMTP_FROM)")
+	fs.StringVar(&c.SMTPUser, "smtp-user", c.SMTPUser, "SMTP username; leave empty to send without authentication (VS_SMTP_USER)")
+	fs.StringVar(&c.SMTPPassword, "smtp-password", c.SMTPPassword, "SMTP password; prefer the variable, flags show up in ps (VS_SMTP_PASSWORD)")
+	fs.StringVar(&c.MailLog, "mail-log", c.MailLog, "File that mail is appended to when no SMTP server is set; defaults to the server log (VS_MAIL_LOG)")
+}
+
+// validate checks the final settings and fills in derived defaults.
+func (c *config) validate() error {
+	if c.SessionTTL <= 0 {
+		return fmt.Errorf("session TTL must be positive, got %s", c.SessionTTL)
+	}
+	if c.SessionMaxAge < c.SessionTTL {
+		return fmt.Errorf("session max age (%s) must be at least the session TTL (%s)", c.SessionMaxAge, c.SessionTTL)
+	}
+	if c.DeleteGrace < 0 {
+		return fmt.Errorf("delete grace must not be negative, got %s", c.DeleteGrace)
+	}
+	if c.BodyLimit <= 0 {
+		return fmt.Errorf("body limit must be positive, got %d", c.BodyLimit)
+	}
+	if c.ReportThreshold < 0 {
+		return fmt.Errorf("report threshold must not be negative, got %d", c.ReportThreshold)
+	}
+	if c.LockoutThreshold < 0 {
+		return fmt.Errorf("lockout threshold must not be negative, got %d", c.LockoutThreshold)
+	}
+	if c.LockoutThreshold > 0 && c.LockoutDuration <= 0 {
+		return fmt.Errorf("lockout duration must be positive, got %s", c.LockoutDuration)
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout must not be negative, got %s", c.ShutdownTimeout)
+	}
+	if c.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			return fmt.Errorf("SMTP address must be host:port, got %q", c.SMTPAddr)
+		}
+		if _, err := mail.ParseAddress(c.SMTPFrom); err != nil {
+			return fmt.Errorf("SMTP sender must be a valid email address, got %q", c.SMTPFrom)
+		}
+		if c.SMTPUser != "" && c.SMTPPassword == "" {
+			return fmt.Errorf("SMTP password is required with an SMTP user")
+		}
+	}
+	if c.BaseURL == "" {
+		host := c.Addr
+		if strings.HasPrefix(host, ":") {
+			host = "localhost" + host
+		}
+		c.BaseURL = "http://" + host
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+	return nil
+}
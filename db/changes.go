@@ -0,0 +1,50 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// EventChange represents a row in the event_changes table: one field of an
+// event that was modified by an edit.
+type EventChange struct {
+	ID        int64     `json:"id"`
+	EventID   int64     `json:"event_id"`
+	Field     string    `json:"field"`     // title | description | event_type | location | start_time | end_time
+	OldValue  *string   `json:"old_value"` // nil when the field was empty (end_time only)
+	NewValue  *string   `json:"new_value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListEventChanges returns the change log of an event, newest first.
+func ListEventChanges(db *sql.DB, eventID int64) ([]EventChange, error) {
+	rows, err := db.Query(`
+		SELECT id, event_id, field, old_value, new_value, created_at
+		FROM event_changes
+		WHERE event_id = ?
+		ORDER BY created_at DESC, id DESC`, eventID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []EventChange{}
+	for rows.Next() {
+		var c EventChange
+		if err := rows.Scan(&c.ID, &c.EventID, &c.Field, &c.OldValue, &c.NewValue, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// timeValue formats an optional time for the change log.
+func timeValue(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
+}
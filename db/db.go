@@ -4,15 +4,20 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
-
-	// SQLite driver — imported for side-effect registration.
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// Init opens (or creates) the SQLite database at dbPath,
-// enables WAL mode and foreign keys, and runs migrations.
-func Init(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+// Open opens (or creates) the SQLite database at dbPath and enables WAL mode
+// and foreign keys. Statements are timed in QueryDuration. It does not touch
+// the schema; see Init.
+func Open(dbPath string) (*sql.DB, error) {
+	// Foreign keys are a per-connection setting, so they go in the DSN for
+	// the driver to apply to every connection in the pool; a PRAGMA would
+	// only reach one of them.
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open(timedDriverName, dbPath+sep+"_foreign_keys=on")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
@@ -23,103 +28,23 @@ func Init(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("enable WAL: %w", err)
 	}
 
-	// Enable foreign-key constraint enforcement.
-	if _, err := db.Exec("PRAGMA foreign_keys=ON"); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("enable foreign keys: %w", err)
+	return db, nil
+}
+
+// Init opens the database and applies any pending schema migrations. The
+// full-text search index is one of them, but it is only created when SQLite
+// was built with FTS5 (see ftsAvailable).
+func Init(dbPath string) (*sql.DB, error) {
+	db, err := Open(dbPath)
+	if err != nil {
+		return nil, err
 	}
 
 	// Run schema migrations.
-	if err := migrate(db); err != nil {
+	if _, err := MigrateUp(db); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("migrate: %w", err)
 	}
 
 	return db, nil
 }
-
-// migrate creates tables that don't already exist.
-func migrate(db *sql.DB) error {
-	const usersTable = `
-	CREATE TABLE IF NOT EXISTS users (
-		id          INTEGER PRIMARY KEY AUTOINCREMENT,
-		name        TEXT    NOT NULL,
-		email       TEXT    NOT NULL UNIQUE,
-		password    TEXT    NOT NULL,
-		role        TEXT    NOT NULL DEFAULT 'villager',
-		created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(usersTable); err != nil {
-		return fmt.Errorf("create users table: %w", err)
-	}
-
-	const sessionsTable = `
-	CREATE TABLE IF NOT EXISTS sessions (
-		token      TEXT     PRIMARY KEY,
-		user_id    INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		expires_at DATETIME NOT NULL
-	);`
-
-	if _, err := db.Exec(sessionsTable); err != nil {
-		return fmt.Errorf("create sessions table: %w", err)
-	}
-
-	// Valid categories: fish, produce, crafts, services, other
-	const postsTable = `
-	CREATE TABLE IF NOT EXISTS posts (
-		id          INTEGER  PRIMARY KEY AUTOINCREMENT,
-		user_id     INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		type        TEXT     NOT NULL CHECK(type IN ('offer', 'request', 'announcement')),
-		title       TEXT     NOT NULL,
-		body        TEXT     NOT NULL DEFAULT '',
-		category    TEXT     NOT NULL DEFAULT 'other',
-		created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(postsTable); err != nil {
-		return fmt.Errorf("create posts table: %w", err)
-	}
-
-	const eventsTable = `
-	CREATE TABLE IF NOT EXISTS events (
-		id          INTEGER  PRIMARY KEY AUTOINCREMENT,
-		user_id     INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		title       TEXT     NOT NULL,
-		description TEXT     NOT NULL DEFAULT '',
-		event_type  TEXT     NOT NULL CHECK(event_type IN ('garage_sale', 'sport', 'gathering', 'other')),
-		location    TEXT     NOT NULL DEFAULT '',
-		start_time  DATETIME NOT NULL,
-		end_time    DATETIME,
-		created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(eventsTable); err != nil {
-		return fmt.Errorf("create events table: %w", err)
-	}
-
-	// Add event_id column to posts if it doesn't exist yet.
-	_, alterErr := db.Exec("ALTER TABLE posts ADD COLUMN event_id INTEGER REFERENCES events(id) ON DELETE SET NULL")
-	if alterErr != nil {
-		// Ignore "duplicate column name" error — means migration already ran.
-		if !strings.Contains(alterErr.Error(), "duplicate column name") {
-			return fmt.Errorf("add event_id column: %w", alterErr)
-		}
-	}
-
-	const interestsTable = `
-	CREATE TABLE IF NOT EXISTS interests (
-		id         INTEGER  PRIMARY KEY AUTOINCREMENT,
-		post_id    INTEGER  NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
-		user_id    INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(post_id, user_id)
-	);`
-
-	if _, err := db.Exec(interestsTable); err != nil {
-		return fmt.Errorf("create interests table: %w", err)
-	}
-
-	return nil
-}
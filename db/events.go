@@ -2,21 +2,48 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 )
 
 // Event represents a row in the events table.
 type Event struct {
-	ID          int64      `json:"id"`
-	UserID      int64      `json:"user_id"`
-	Author      string     `json:"author"` // populated from JOIN
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	EventType   string     `json:"event_type"` // garage_sale | sport | gathering | other
-	Location    string     `json:"location"`
-	StartTime   time.Time  `json:"start_time"`
-	EndTime     *time.Time `json:"end_time"` // nullable
-	CreatedAt   time.Time  `json:"created_at"`
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"` // the organiser; their profile is at /api/users/{id}
+	Author       string     `json:"author"`  // populated from JOIN
+	AuthorAvatar string     `json:"author_avatar"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	EventType    string     `json:"event_type"` // garage_sale | sport | gathering | other
+	Location     string     `json:"location"`
+	StartTime    time.Time  `json:"start_time"`
+	EndTime      *time.Time `json:"end_time"` // nullable
+	CreatedAt    time.Time  `json:"created_at"`
+	TimeChanged  bool       `json:"time_changed"` // start or end time was edited after creation
+	Hidden       bool       `json:"hidden"`       // hidden by a moderator
+}
+
+// timeChangedColumn reports whether an event's start or end time has ever been
+// edited, for the "time changed" badge.
+const timeChangedColumn = `EXISTS(SELECT 1 FROM event_changes c
+		           WHERE c.event_id = e.id AND c.field IN ('start_time', 'end_time'))`
+
+// eventColumns and eventJoins make up eventSelect, the SELECT shared by event
+// queries; queries that start from another table use them directly.
+const (
+	eventColumns = `e.id, e.user_id, u.name, u.avatar, e.title, e.description, e.event_type,
+		       e.location, e.start_time, e.end_time, e.created_at, ` + timeChangedColumn + `,
+		       e.hidden_at IS NOT NULL`
+	eventJoins  = `JOIN users u ON u.id = e.user_id`
+	eventSelect = "SELECT " + eventColumns + " FROM events e " + eventJoins
+)
+
+// scanEvent scans a row selected with eventColumns into e, followed by any
+// extra columns into extra.
+func scanEvent(row interface{ Scan(...any) error }, e *Event, extra ...any) error {
+	return row.Scan(append([]any{&e.ID, &e.UserID, &e.Author, &e.AuthorAvatar, &e.Title, &e.Description, &e.EventType,
+		&e.Location, &e.StartTime, &e.EndTime, &e.CreatedAt, &e.TimeChanged, &e.Hidden}, extra...)...)
 }
 
 // CreateEvent inserts a new event and returns it with the author name populated.
@@ -42,35 +69,87 @@ func CreateEvent(db *sql.DB, userID int64, title, description, eventType, locati
 // Returns sql.ErrNoRows if not found.
 func GetEventByID(db *sql.DB, id int64) (*Event, error) {
 	e := &Event{}
-	err := db.QueryRow(`
-		SELECT e.id, e.user_id, u.name, e.title, e.description, e.event_type,
-		       e.location, e.start_time, e.end_time, e.created_at
-		FROM events e
-		JOIN users u ON u.id = e.user_id
-		WHERE e.id = ?`, id,
-	).Scan(&e.ID, &e.UserID, &e.Author, &e.Title, &e.Description, &e.EventType,
-		&e.Location, &e.StartTime, &e.EndTime, &e.CreatedAt)
-	if err != nil {
+	if err := scanEvent(db.QueryRow(eventSelect+" WHERE e.id = ?", id), e); err != nil {
 		return nil, err
 	}
 	return e, nil
 }
 
-// ListEvents returns events ordered by start_time ASC, optionally filtered by event_type.
-func ListEvents(db *sql.DB, eventType string) ([]Event, error) {
-	query := `SELECT e.id, e.user_id, u.name, e.title, e.description, e.event_type,
-		       e.location, e.start_time, e.end_time, e.created_at
-		FROM events e
-		JOIN users u ON u.id = e.user_id`
+// EventFilter narrows ListEvents and CountEvents. Empty fields don't filter.
+// Events hidden by a moderator are always left out.
+type EventFilter struct {
+	Type string
+	// Upcoming keeps events that haven't finished yet. An event without an
+	// end time counts as running until the end of its start day.
+	Upcoming bool
+}
 
+// where returns the SQL conditions and arguments for the filter, for use
+// against "events e".
+func (f EventFilter) where() ([]string, []any) {
+	conditions := []string{"e.hidden_at IS NULL"}
 	var args []any
-	if eventType != "" {
-		query += " WHERE e.event_type = ?"
-		args = append(args, eventType)
+
+	if f.Type != "" {
+		conditions = append(conditions, "e.event_type = ?")
+		args = append(args, f.Type)
 	}
-	query += " ORDER BY e.start_time ASC"
+	if f.Upcoming {
+		conditions = append(conditions,
+			"COALESCE(datetime(e.end_time), datetime(e.start_time, 'start of day', '+1 day')) > datetime('now')")
+	}
+	return conditions, args
+}
+
+// ListEvents returns up to limit events matching the filter ordered by
+// start_time ASC, starting after the given cursor (nil for the first page).
+// The returned cursor points at the next page and is nil when there are no
+// more events.
+func ListEvents(db *sql.DB, filter EventFilter, limit int, after *Cursor) ([]Event, *Cursor, error) {
+	query := eventSelect
+
+	conditions, args := filter.where()
+	if after != nil {
+		conditions = append(conditions, "(datetime(e.start_time), e.id) > (?, ?)")
+		args = append(args, after.sqlTime(), after.ID)
+	}
+
+	query += " WHERE " + strings.Join(conditions, " AND ")
+	// Fetch one extra row to learn whether another page follows.
+	query += " ORDER BY datetime(e.start_time) ASC, e.id ASC LIMIT ?"
+	args = append(args, limit+1)
 
 	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := scanEvent(rows, &e); err != nil {
+			return nil, nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[limit-1]
+		next = &Cursor{Time: last.StartTime, ID: last.ID}
+	}
+	return events, next, nil
+}
+
+// ListUserEvents returns every event the user created, hidden or not, newest
+// first.
+func ListUserEvents(db *sql.DB, userID int64) ([]Event, error) {
+	rows, err := db.Query(eventSelect+" WHERE e.user_id = ? ORDER BY datetime(e.created_at) DESC, e.id DESC", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -79,8 +158,7 @@ func ListEvents(db *sql.DB, eventType string) ([]Event, error) {
 	events := []Event{}
 	for rows.Next() {
 		var e Event
-		if err := rows.Scan(&e.ID, &e.UserID, &e.Author, &e.Title, &e.Description, &e.EventType,
-			&e.Location, &e.StartTime, &e.EndTime, &e.CreatedAt); err != nil {
+		if err := scanEvent(rows, &e); err != nil {
 			return nil, err
 		}
 		events = append(events, e)
@@ -88,6 +166,87 @@ func ListEvents(db *sql.DB, eventType string) ([]Event, error) {
 	return events, rows.Err()
 }
 
+// CountEvents returns the number of events matching the filter, across all
+// pages.
+func CountEvents(db *sql.DB, filter EventFilter) (int, error) {
+	conditions, args := filter.where()
+	query := "SELECT COUNT(*) FROM events e WHERE " + strings.Join(conditions, " AND ")
+
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// UpdateEvent replaces the fields of an event owned by userID and records one
+// event_changes row per modified field in the same transaction. Linked posts
+// stay attached because the event row is updated in place. Returns
+// ErrNotFound if the event doesn't exist or doesn't belong to the user.
+func UpdateEvent(db *sql.DB, eventID, userID int64, title, description, eventType, location string, startTime time.Time, endTime *time.Time) (*Event, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var old Event
+	err = tx.QueryRow(`
+		SELECT title, description, event_type, location, start_time, end_time
+		FROM events WHERE id = ? AND user_id = ?`, eventID, userID,
+	).Scan(&old.Title, &old.Description, &old.EventType, &old.Location, &old.StartTime, &old.EndTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type change struct {
+		field    string
+		old, new *string
+	}
+	var changes []change
+	addText := func(field, oldVal, newVal string) {
+		if oldVal != newVal {
+			changes = append(changes, change{field, &oldVal, &newVal})
+		}
+	}
+	addText("title", old.Title, title)
+	addText("description", old.Description, description)
+	addText("event_type", old.EventType, eventType)
+	addText("location", old.Location, location)
+	if !old.StartTime.Equal(startTime) {
+		changes = append(changes, change{"start_time", timeValue(&old.StartTime), timeValue(&startTime)})
+	}
+	if oldEnd, newEnd := timeValue(old.EndTime), timeValue(endTime); !equalPtr(oldEnd, newEnd) {
+		changes = append(changes, change{"end_time", oldEnd, newEnd})
+	}
+
+	if len(changes) > 0 {
+		for _, c := range changes {
+			if _, err := tx.Exec(
+				"INSERT INTO event_changes (event_id, field, old_value, new_value) VALUES (?, ?, ?, ?)",
+				eventID, c.field, c.old, c.new,
+			); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.Exec(`
+			UPDATE events
+			SET title = ?, description = ?, event_type = ?, location = ?, start_time = ?, end_time = ?
+			WHERE id = ?`,
+			title, description, eventType, location, startTime, endTime, eventID,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetEventByID(db, eventID)
+}
+
 // DeleteEvent deletes an event only if it belongs to the given user.
 // Returns ErrNotFound if no matching row was deleted.
 func DeleteEvent(db *sql.DB, eventID, userID int64) error {
@@ -4,11 +4,29 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"time"
 )
 
 // ErrAlreadyInterested is returned when a user tries to express interest twice.
 var ErrAlreadyInterested = errors.New("already interested")
 
+// Interest is one villager's interest in a post, as shown to the post's author.
+type Interest struct {
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`     // populated from JOIN
+	Position  int       `json:"position"` // 1 for the first villager to show interest
+	Chosen    bool      `json:"chosen"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserInterest is a post the user showed interest in, as listed for the user.
+type UserInterest struct {
+	PostID    int64     `json:"post_id"`
+	PostTitle string    `json:"post_title"` // populated from JOIN
+	Chosen    bool      `json:"chosen"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // CreateInterest records a user's interest in a post.
 func CreateInterest(db *sql.DB, postID, userID int64) error {
 	_, err := db.Exec(
@@ -47,11 +65,121 @@ func HasUserInterest(db *sql.DB, postID, userID int64) (bool, error) {
 	return true, nil
 }
 
-// DeleteInterest removes a user's interest in a post.
+// DeleteInterest removes a user's interest in a post. If it was the chosen
+// interest, a reserved post becomes available again.
 func DeleteInterest(db *sql.DB, postID, userID int64) error {
-	res, err := db.Exec(
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var chosen bool
+	err = tx.QueryRow(
+		"SELECT chosen_at IS NOT NULL FROM interests WHERE post_id = ? AND user_id = ?",
+		postID, userID,
+	).Scan(&chosen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
 		"DELETE FROM interests WHERE post_id = ? AND user_id = ?",
 		postID, userID,
+	); err != nil {
+		return err
+	}
+	if chosen {
+		if err := reopenReserved(tx, postID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListInterests returns everyone interested in a post, in the order they
+// registered their interest.
+func ListInterests(db *sql.DB, postID int64) ([]Interest, error) {
+	rows, err := db.Query(`
+		SELECT i.user_id, u.name, i.chosen_at IS NOT NULL, i.created_at
+		FROM interests i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.post_id = ?
+		ORDER BY datetime(i.created_at) ASC, i.id ASC`, postID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	interests := []Interest{}
+	for rows.Next() {
+		var in Interest
+		if err := rows.Scan(&in.UserID, &in.Name, &in.Chosen, &in.CreatedAt); err != nil {
+			return nil, err
+		}
+		in.Position = len(interests) + 1
+		interests = append(interests, in)
+	}
+	return interests, rows.Err()
+}
+
+// ListUserInterests returns every post the user is interested in, newest
+// interest first.
+func ListUserInterests(db *sql.DB, userID int64) ([]UserInterest, error) {
+	rows, err := db.Query(`
+		SELECT i.post_id, p.title, i.chosen_at IS NOT NULL, i.created_at
+		FROM interests i
+		JOIN posts p ON p.id = i.post_id
+		WHERE i.user_id = ?
+		ORDER BY datetime(i.created_at) DESC, i.id DESC`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	interests := []UserInterest{}
+	for rows.Next() {
+		var in UserInterest
+		if err := rows.Scan(&in.PostID, &in.PostTitle, &in.Chosen, &in.CreatedAt); err != nil {
+			return nil, err
+		}
+		interests = append(interests, in)
+	}
+	return interests, rows.Err()
+}
+
+// ChooseInterest marks userID's interest in a post as the chosen one,
+// replacing any earlier choice, and reserves the post. Returns ErrNotFound if
+// that user isn't interested in the post, and ErrInvalidTransition if the
+// post is completed or expired.
+func ChooseInterest(db *sql.DB, postID, userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRow("SELECT status FROM posts WHERE id = ?", postID).Scan(&status); err != nil {
+		return err
+	}
+	if status != StatusAvailable && status != StatusReserved {
+		return ErrInvalidTransition
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE interests SET chosen_at = NULL WHERE post_id = ? AND user_id != ?", postID, userID,
+	); err != nil {
+		return err
+	}
+	res, err := tx.Exec(
+		"UPDATE interests SET chosen_at = COALESCE(chosen_at, CURRENT_TIMESTAMP) WHERE post_id = ? AND user_id = ?",
+		postID, userID,
 	)
 	if err != nil {
 		return err
@@ -63,5 +191,51 @@ func DeleteInterest(db *sql.DB, postID, userID int64) error {
 	if n == 0 {
 		return ErrNotFound
 	}
-	return nil
+
+	if status == StatusAvailable {
+		if err := setStatus(tx, postID, StatusReserved); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UnchooseInterest undoes ChooseInterest, moving a reserved post back to
+// available. Returns ErrNotFound if userID's interest isn't the chosen one.
+func UnchooseInterest(db *sql.DB, postID, userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE interests SET chosen_at = NULL WHERE post_id = ? AND user_id = ? AND chosen_at IS NOT NULL",
+		postID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	if err := reopenReserved(tx, postID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// reopenReserved moves a reserved post back to available once it no longer
+// has a chosen interest.
+func reopenReserved(tx *sql.Tx, postID int64) error {
+	_, err := tx.Exec(
+		"UPDATE posts SET status = ?, status_changed_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		StatusAvailable, postID, StatusReserved,
+	)
+	return err
 }
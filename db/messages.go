@@ -0,0 +1,228 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Conversation is a message thread about one post between its author and one
+// other villager, as seen by one of the two participants.
+type Conversation struct {
+	ID            int64      `json:"id"`
+	PostID        int64      `json:"post_id"`
+	PostTitle     string     `json:"post_title"` // populated from JOIN
+	AuthorID      int64      `json:"author_id"`
+	VillagerID    int64      `json:"villager_id"`
+	OtherUserID   int64      `json:"other_user_id"` // the participant who isn't the caller
+	OtherName     string     `json:"other_name"`
+	LastMessage   *string    `json:"last_message"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+	Unread        int        `json:"unread"` // messages to the caller not yet read
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Message represents a row in the messages table.
+type Message struct {
+	ID             int64      `json:"id"`
+	ConversationID int64      `json:"conversation_id"`
+	SenderID       int64      `json:"sender_id"`
+	SenderName     string     `json:"sender"` // populated from JOIN
+	Body           string     `json:"body"`
+	ReadAt         *time.Time `json:"read_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// conversationSelect is the shared SELECT for conversations from one user's
+// point of view. Its two placeholders are that user's ID, for working out the
+// other participant and the unread count.
+const conversationSelect = `
+	SELECT c.id, c.post_id, p.title, c.author_id, c.villager_id, o.id, o.name,
+	       (SELECT m.body FROM messages m WHERE m.conversation_id = c.id ORDER BY m.id DESC LIMIT 1),
+	       (SELECT m.created_at FROM messages m WHERE m.conversation_id = c.id ORDER BY m.id DESC LIMIT 1),
+	       (SELECT COUNT(*) FROM messages m
+	        WHERE m.conversation_id = c.id AND m.sender_id != ?1 AND m.read_at IS NULL),
+	       c.created_at
+	FROM conversations c
+	JOIN posts p ON p.id = c.post_id
+	JOIN users o ON o.id = CASE WHEN c.author_id = ?1 THEN c.villager_id ELSE c.author_id END`
+
+// scanConversation scans one row of conversationSelect.
+func scanConversation(row interface{ Scan(...any) error }, c *Conversation) error {
+	return row.Scan(&c.ID, &c.PostID, &c.PostTitle, &c.AuthorID, &c.VillagerID, &c.OtherUserID,
+		&c.OtherName, &c.LastMessage, &c.LastMessageAt, &c.Unread, &c.CreatedAt)
+}
+
+// StartConversation sends a message from villagerID to the author of a post,
+// creating their conversation about the post if this is the first message.
+func StartConversation(db *sql.DB, postID, authorID, villagerID int64, body string) (*Message, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO conversations (post_id, author_id, villager_id) VALUES (?, ?, ?) ON CONFLICT(post_id, villager_id) DO NOTHING",
+		postID, authorID, villagerID,
+	); err != nil {
+		return nil, err
+	}
+	var conversationID int64
+	if err := tx.QueryRow(
+		"SELECT id FROM conversations WHERE post_id = ? AND villager_id = ?", postID, villagerID,
+	).Scan(&conversationID); err != nil {
+		return nil, err
+	}
+
+	m, err := insertMessage(tx, conversationID, villagerID, body)
+	if err != nil {
+		return nil, err
+	}
+	return m, tx.Commit()
+}
+
+// CreateMessage adds a message to an existing conversation. Returns
+// ErrNotFound unless senderID is one of its two participants.
+func CreateMessage(db *sql.DB, conversationID, senderID int64, body string) (*Message, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var one int
+	err = tx.QueryRow(
+		"SELECT 1 FROM conversations WHERE id = ? AND (author_id = ? OR villager_id = ?)",
+		conversationID, senderID, senderID,
+	).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := insertMessage(tx, conversationID, senderID, body)
+	if err != nil {
+		return nil, err
+	}
+	return m, tx.Commit()
+}
+
+// insertMessage stores a message and bumps the conversation's updated_at so
+// it sorts to the top of both participants' lists.
+func insertMessage(tx *sql.Tx, conversationID, senderID int64, body string) (*Message, error) {
+	res, err := tx.Exec(
+		"INSERT INTO messages (conversation_id, sender_id, body) VALUES (?, ?, ?)",
+		conversationID, senderID, body,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(
+		"UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", conversationID,
+	); err != nil {
+		return nil, err
+	}
+
+	m := &Message{}
+	err = tx.QueryRow(`
+		SELECT m.id, m.conversation_id, m.sender_id, u.name, m.body, m.read_at, m.created_at
+		FROM messages m JOIN users u ON u.id = m.sender_id
+		WHERE m.id = ?`, id,
+	).Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SenderName, &m.Body, &m.ReadAt, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ListConversations returns the user's conversations, most recently active
+// first.
+func ListConversations(db *sql.DB, userID int64) ([]Conversation, error) {
+	rows, err := db.Query(conversationSelect+`
+		WHERE c.author_id = ?1 OR c.villager_id = ?1
+		ORDER BY datetime(c.updated_at) DESC, c.id DESC`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		var c Conversation
+		if err := scanConversation(rows, &c); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// GetConversation returns one conversation as seen by userID. Returns
+// ErrNotFound if it doesn't exist or userID isn't a participant.
+func GetConversation(db *sql.DB, id, userID int64) (*Conversation, error) {
+	c := &Conversation{}
+	err := scanConversation(db.QueryRow(conversationSelect+`
+		WHERE c.id = ?2 AND (c.author_id = ?1 OR c.villager_id = ?1)`, userID, id,
+	), c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListMessages returns all messages in a conversation, oldest first.
+func ListMessages(db *sql.DB, conversationID int64) ([]Message, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.conversation_id, m.sender_id, u.name, m.body, m.read_at, m.created_at
+		FROM messages m JOIN users u ON u.id = m.sender_id
+		WHERE m.conversation_id = ?
+		ORDER BY m.id ASC`, conversationID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SenderName, &m.Body, &m.ReadAt, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// MarkConversationRead marks every message sent to userID in the
+// conversation as read.
+func MarkConversationRead(db *sql.DB, conversationID, userID int64) error {
+	_, err := db.Exec(
+		"UPDATE messages SET read_at = CURRENT_TIMESTAMP WHERE conversation_id = ? AND sender_id != ? AND read_at IS NULL",
+		conversationID, userID,
+	)
+	return err
+}
+
+// CountUnreadMessages returns the number of unread messages sent to userID
+// across all of their conversations.
+func CountUnreadMessages(db *sql.DB, userID int64) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE (c.author_id = ?1 OR c.villager_id = ?1) AND m.sender_id != ?1 AND m.read_at IS NULL`, userID,
+	).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"village-square/metrics"
+)
+
+// QueryDuration times every statement run through a database from Open, by
+// kind of statement (select, insert, update, delete or other). Query times
+// run until the rows are closed, so they include reading the results.
+var QueryDuration = metrics.NewHistogram(
+	"vs_db_query_duration_seconds",
+	"Time spent running database statements.",
+	metrics.DefaultBuckets, "op",
+)
+
+// timedDriverName is the SQLite driver wrapped to record QueryDuration.
+const timedDriverName = "sqlite3-timed"
+
+func init() {
+	sql.Register(timedDriverName, timedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+// timedDriver opens SQLite connections that time their statements. It only
+// wraps the context-aware paths database/sql takes for Exec and Query, with
+// or without a transaction; prepared statements are not used in this package.
+type timedDriver struct {
+	driver.Driver
+}
+
+func (d timedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type timedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	QueryDuration.Observe(time.Since(start).Seconds(), queryOp(query))
+	return res, err
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		QueryDuration.Observe(time.Since(start).Seconds(), queryOp(query))
+		return nil, err
+	}
+	return &timedRows{Rows: rows, start: start, op: queryOp(query)}, nil
+}
+
+// timedRows records the query's duration when its rows are closed.
+type timedRows struct {
+	driver.Rows
+	start time.Time
+	op    string
+}
+
+func (r *timedRows) Close() error {
+	QueryDuration.Observe(time.Since(r.start).Seconds(), r.op)
+	return r.Rows.Close()
+}
+
+// queryOp classifies a statement by its first keyword.
+func queryOp(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete":
+		return op
+	case "with":
+		return "select"
+	}
+	return "other"
+}
+
+// Stats are row counts for the metrics endpoint.
+type Stats struct {
+	ActiveSessions int64
+	PostsByStatus  map[string]int64
+	Events         int64
+	Interests      int64
+}
+
+// CountStats counts unexpired sessions, posts by status, events and
+// interests. Hidden posts and events are included.
+func CountStats(db *sql.DB) (*Stats, error) {
+	s := &Stats{PostsByStatus: map[string]int64{}}
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE expires_at > datetime('now')",
+	).Scan(&s.ActiveSessions); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM events").Scan(&s.Events); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM interests").Scan(&s.Interests); err != nil {
+		return nil, err
+	}
+
+	// Report every status, even with no posts, so the series don't vanish.
+	for _, status := range []string{StatusAvailable, StatusReserved, StatusCompleted, StatusExpired} {
+		s.PostsByStatus[status] = 0
+	}
+	rows, err := db.Query("SELECT status, COUNT(*) FROM posts GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int64
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		s.PostsByStatus[status] = n
+	}
+	return s, rows.Err()
+}
@@ -0,0 +1,728 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// migration is one numbered schema change. Versions are applied in ascending
+// order, each inside its own transaction.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+	down    func(tx *sql.Tx) error // nil if the migration can't be reverted
+	fts     bool                   // needs SQLite built with FTS5; see MigrateUp
+}
+
+// MigrationState describes a migration and whether it has been applied.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil if pending
+}
+
+// ErrNoFTS is returned by MigrateUp when the database has a migration that
+// needs FTS5 applied but the linked SQLite doesn't include it. Its triggers
+// would make every write to posts and events fail.
+var ErrNoFTS = errors.New("database has a full-text search index but SQLite lacks FTS5; build with -tags sqlite_fts5")
+
+// ErrIrreversible is returned by MigrateDown when the latest applied migration
+// has no down step.
+var ErrIrreversible = errors.New("migration cannot be reverted")
+
+// execSQL returns a migration step that runs the given statements.
+func execSQL(stmts string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmts)
+		return err
+	}
+}
+
+// migrations is the ordered schema history. Never edit or renumber an entry
+// that has shipped; add a new one instead. The early entries use IF NOT EXISTS
+// because they describe tables that databases created before versioning
+// already have.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create_users",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS users (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			name        TEXT    NOT NULL,
+			email       TEXT    NOT NULL UNIQUE,
+			password    TEXT    NOT NULL,
+			role        TEXT    NOT NULL DEFAULT 'villager',
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`DROP TABLE users;`),
+	},
+	{
+		version: 2,
+		name:    "create_sessions",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			token      TEXT     PRIMARY KEY,
+			user_id    INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);`),
+		down: execSQL(`DROP TABLE sessions;`),
+	},
+	{
+		// Valid categories: fish, produce, crafts, services, other
+		version: 3,
+		name:    "create_posts",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS posts (
+			id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+			user_id     INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			type        TEXT     NOT NULL CHECK(type IN ('offer', 'request', 'announcement')),
+			title       TEXT     NOT NULL,
+			body        TEXT     NOT NULL DEFAULT '',
+			category    TEXT     NOT NULL DEFAULT 'other',
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`DROP TABLE posts;`),
+	},
+	{
+		version: 4,
+		name:    "create_events",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS events (
+			id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+			user_id     INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			title       TEXT     NOT NULL,
+			description TEXT     NOT NULL DEFAULT '',
+			event_type  TEXT     NOT NULL CHECK(event_type IN ('garage_sale', 'sport', 'gathering', 'other')),
+			location    TEXT     NOT NULL DEFAULT '',
+			start_time  DATETIME NOT NULL,
+			end_time    DATETIME,
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`DROP TABLE events;`),
+	},
+	{
+		// SQLite can't drop a column that takes part in a foreign key, so this
+		// one has no down step.
+		version: 5,
+		name:    "add_posts_event_id",
+		up: func(tx *sql.Tx) error {
+			has, err := hasColumn(tx, "posts", "event_id")
+			if err != nil || has {
+				return err
+			}
+			_, err = tx.Exec("ALTER TABLE posts ADD COLUMN event_id INTEGER REFERENCES events(id) ON DELETE SET NULL")
+			return err
+		},
+	},
+	{
+		version: 6,
+		name:    "create_interests",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS interests (
+			id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+			post_id    INTEGER  NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			user_id    INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(post_id, user_id)
+		);`),
+		down: execSQL(`DROP TABLE interests;`),
+	},
+	{
+		// Each row is a prior version of a post, saved just before an edit.
+		version: 7,
+		name:    "create_post_revisions",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS post_revisions (
+			id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+			post_id    INTEGER  NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			title      TEXT     NOT NULL,
+			body       TEXT     NOT NULL DEFAULT '',
+			category   TEXT     NOT NULL DEFAULT 'other',
+			event_id   INTEGER  REFERENCES events(id) ON DELETE SET NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`DROP TABLE post_revisions;`),
+	},
+	{
+		// One row per field changed by an event edit; values are stored as text.
+		version: 8,
+		name:    "create_event_changes",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS event_changes (
+			id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+			event_id   INTEGER  NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+			field      TEXT     NOT NULL,
+			old_value  TEXT,
+			new_value  TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`DROP TABLE event_changes;`),
+	},
+	{
+		// Keyset-pagination indexes: they match the ORDER BY of ListPosts and
+		// ListEvents, so fetching a page doesn't sort the whole table.
+		version: 9,
+		name:    "add_list_indexes",
+		up: execSQL(`
+		CREATE INDEX IF NOT EXISTS idx_posts_feed ON posts(datetime(created_at), id);
+		CREATE INDEX IF NOT EXISTS idx_events_timeline ON events(datetime(start_time), id);`),
+		down: execSQL(`
+		DROP INDEX idx_posts_feed;
+		DROP INDEX idx_events_timeline;`),
+	},
+	{
+		// Only a SHA-256 of each reset token is stored; used_at makes tokens single-use.
+		version: 10,
+		name:    "create_password_resets",
+		up: execSQL(`
+		CREATE TABLE password_resets (
+			id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+			user_id    INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash TEXT     NOT NULL UNIQUE,
+			expires_at DATETIME NOT NULL,
+			used_at    DATETIME,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`DROP TABLE password_resets;`),
+	},
+	{
+		// Accounts that existed before verification was introduced are
+		// grandfathered in as verified.
+		version: 11,
+		name:    "add_email_verification",
+		up: execSQL(`
+		ALTER TABLE users ADD COLUMN verified_at DATETIME;
+		UPDATE users SET verified_at = created_at;
+		CREATE TABLE email_verifications (
+			id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+			user_id    INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash TEXT     NOT NULL UNIQUE,
+			expires_at DATETIME NOT NULL,
+			used_at    DATETIME,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`
+		DROP TABLE email_verifications;
+		ALTER TABLE users DROP COLUMN verified_at;`),
+	},
+	{
+		// Moderation: admins can hide content and suspend accounts, and every
+		// action they take is logged. admin_id survives the admin's deletion.
+		version: 12,
+		name:    "add_moderation",
+		up: execSQL(`
+		ALTER TABLE posts ADD COLUMN hidden_at DATETIME;
+		ALTER TABLE events ADD COLUMN hidden_at DATETIME;
+		ALTER TABLE users ADD COLUMN suspended_at DATETIME;
+		CREATE TABLE moderation_log (
+			id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+			admin_id    INTEGER  REFERENCES users(id) ON DELETE SET NULL,
+			action      TEXT     NOT NULL,
+			target_type TEXT     NOT NULL CHECK(target_type IN ('post', 'event', 'user')),
+			target_id   INTEGER  NOT NULL,
+			reason      TEXT     NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`),
+		down: execSQL(`
+		DROP TABLE moderation_log;
+		ALTER TABLE users DROP COLUMN suspended_at;
+		ALTER TABLE events DROP COLUMN hidden_at;
+		ALTER TABLE posts DROP COLUMN hidden_at;`),
+	},
+	{
+		version: 13,
+		name:    "create_reports",
+		up: execSQL(`
+		CREATE TABLE reports (
+			id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+			reporter_id INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			post_id     INTEGER  REFERENCES posts(id) ON DELETE CASCADE,
+			event_id    INTEGER  REFERENCES events(id) ON DELETE CASCADE,
+			reason      TEXT     NOT NULL,
+			status      TEXT     NOT NULL DEFAULT 'open' CHECK(status IN ('open', 'dismissed', 'actioned')),
+			resolved_by INTEGER  REFERENCES users(id) ON DELETE SET NULL,
+			resolved_at DATETIME,
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			CHECK((post_id IS NULL) != (event_id IS NULL)),
+			UNIQUE(reporter_id, post_id),
+			UNIQUE(reporter_id, event_id)
+		);
+		CREATE INDEX idx_reports_status ON reports(status, created_at);`),
+		down: execSQL(`DROP TABLE reports;`),
+	},
+	{
+		version: 14,
+		name:    "create_conversations",
+		up: execSQL(`
+		CREATE TABLE conversations (
+			id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+			post_id     INTEGER  NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			author_id   INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			villager_id INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(post_id, villager_id)
+		);
+		CREATE INDEX idx_conversations_author ON conversations(author_id);
+		CREATE INDEX idx_conversations_villager ON conversations(villager_id);
+		CREATE TABLE messages (
+			id              INTEGER  PRIMARY KEY AUTOINCREMENT,
+			conversation_id INTEGER  NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			sender_id       INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			body            TEXT     NOT NULL,
+			read_at         DATETIME,
+			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX idx_messages_conversation ON messages(conversation_id, id);`),
+		down: execSQL(`
+		DROP TABLE messages;
+		DROP TABLE conversations;`),
+	},
+	{
+		// The author can choose one interested villager per post, which
+		// reserves the post for them.
+		version: 15,
+		name:    "add_interests_chosen_at",
+		up: execSQL(`
+		ALTER TABLE interests ADD COLUMN chosen_at DATETIME;
+		CREATE UNIQUE INDEX idx_interests_chosen ON interests(post_id) WHERE chosen_at IS NOT NULL;`),
+		down: execSQL(`
+		DROP INDEX idx_interests_chosen;
+		ALTER TABLE interests DROP COLUMN chosen_at;`),
+	},
+	{
+		// Posts with a chosen interest start out reserved.
+		version: 16,
+		name:    "add_posts_status",
+		up: execSQL(`
+		ALTER TABLE posts ADD COLUMN status TEXT NOT NULL DEFAULT 'available'
+			CHECK(status IN ('available', 'reserved', 'completed', 'expired'));
+		ALTER TABLE posts ADD COLUMN status_changed_at DATETIME;
+		UPDATE posts SET status = 'reserved'
+			WHERE id IN (SELECT post_id FROM interests WHERE chosen_at IS NOT NULL);`),
+		down: execSQL(`
+		ALTER TABLE posts DROP COLUMN status_changed_at;
+		ALTER TABLE posts DROP COLUMN status;`),
+	},
+	{
+		version: 17,
+		name:    "add_login_lockout",
+		up: execSQL(`
+		ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE users ADD COLUMN locked_until DATETIME;`),
+		down: execSQL(`
+		ALTER TABLE users DROP COLUMN locked_until;
+		ALTER TABLE users DROP COLUMN failed_logins;`),
+	},
+	{
+		// Sessions get an ID so users can revoke them one by one, plus the
+		// device details shown in their session list. Existing sessions are
+		// kept.
+		version: 18,
+		name:    "add_session_details",
+		up: execSQL(`
+		CREATE TABLE sessions_new (
+			id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+			token        TEXT     NOT NULL UNIQUE,
+			user_id      INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent   TEXT     NOT NULL DEFAULT '',
+			ip           TEXT     NOT NULL DEFAULT '',
+			created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at   DATETIME NOT NULL
+		);
+		INSERT INTO sessions_new (token, user_id, created_at, last_seen_at, expires_at)
+			SELECT token, user_id, created_at, created_at, expires_at FROM sessions ORDER BY created_at;
+		DROP TABLE sessions;
+		ALTER TABLE sessions_new RENAME TO sessions;
+		CREATE INDEX idx_sessions_user ON sessions(user_id);`),
+		down: execSQL(`
+		CREATE TABLE sessions_old (
+			token      TEXT     PRIMARY KEY,
+			user_id    INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+		INSERT INTO sessions_old (token, user_id, created_at, expires_at)
+			SELECT token, user_id, created_at, expires_at FROM sessions;
+		DROP TABLE sessions;
+		ALTER TABLE sessions_old RENAME TO sessions;`),
+	},
+	{
+		// Sessions store a SHA-256 of their token instead of the token, and
+		// slide: each use pushes expires_at out by idle_timeout seconds, up
+		// to max_expires_at. Existing sessions stay logged in with their
+		// original expiry (idle_timeout 0 means no sliding).
+		version: 19,
+		name:    "hash_session_tokens",
+		up:      hashSessionTokens,
+		// Hashes can't be turned back into tokens, so going down logs
+		// everyone out.
+		down: execSQL(`
+		DROP TABLE sessions;
+		CREATE TABLE sessions (
+			id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+			token        TEXT     NOT NULL UNIQUE,
+			user_id      INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent   TEXT     NOT NULL DEFAULT '',
+			ip           TEXT     NOT NULL DEFAULT '',
+			created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at   DATETIME NOT NULL
+		);
+		CREATE INDEX idx_sessions_user ON sessions(user_id);`),
+	},
+	{
+		// Accounts deleted with a grace period are removed once
+		// delete_after has passed.
+		version: 20,
+		name:    "add_account_deletion",
+		up:      execSQL(`ALTER TABLE users ADD COLUMN delete_after DATETIME;`),
+		down:    execSQL(`ALTER TABLE users DROP COLUMN delete_after;`),
+	},
+	{
+		version: 21,
+		name:    "add_user_profile",
+		up: execSQL(`
+		ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+		ALTER TABLE users ADD COLUMN avatar TEXT NOT NULL DEFAULT '';`),
+		down: execSQL(`
+		ALTER TABLE users DROP COLUMN avatar;
+		ALTER TABLE users DROP COLUMN bio;`),
+	},
+	{
+		// One FTS5 index over posts and events, so their bm25 scores come
+		// from the same statistics and can be ranked together. Posts are
+		// stored at rowid 2*id and events at 2*id+1, which lets the triggers
+		// find a row without scanning. Builds before versioning created
+		// separate posts_fts and events_fts tables; they are replaced.
+		version: 22,
+		name:    "create_search_index",
+		fts:     true,
+		up: execSQL(`
+		DROP TRIGGER IF EXISTS posts_fts_ai;
+		DROP TRIGGER IF EXISTS posts_fts_ad;
+		DROP TRIGGER IF EXISTS posts_fts_au;
+		DROP TRIGGER IF EXISTS events_fts_ai;
+		DROP TRIGGER IF EXISTS events_fts_ad;
+		DROP TRIGGER IF EXISTS events_fts_au;
+		DROP TABLE IF EXISTS posts_fts;
+		DROP TABLE IF EXISTS events_fts;
+
+		CREATE VIRTUAL TABLE search_fts USING fts5(kind UNINDEXED, title, body, location);
+
+		CREATE TRIGGER search_posts_ai AFTER INSERT ON posts BEGIN
+			INSERT INTO search_fts(rowid, kind, title, body, location)
+			VALUES (2 * new.id, 'post', new.title, new.body, '');
+		END;
+		CREATE TRIGGER search_posts_ad AFTER DELETE ON posts BEGIN
+			DELETE FROM search_fts WHERE rowid = 2 * old.id;
+		END;
+		CREATE TRIGGER search_posts_au AFTER UPDATE OF title, body ON posts BEGIN
+			UPDATE search_fts SET title = new.title, body = new.body WHERE rowid = 2 * new.id;
+		END;
+
+		CREATE TRIGGER search_events_ai AFTER INSERT ON events BEGIN
+			INSERT INTO search_fts(rowid, kind, title, body, location)
+			VALUES (2 * new.id + 1, 'event', new.title, new.description, new.location);
+		END;
+		CREATE TRIGGER search_events_ad AFTER DELETE ON events BEGIN
+			DELETE FROM search_fts WHERE rowid = 2 * old.id + 1;
+		END;
+		CREATE TRIGGER search_events_au AFTER UPDATE OF title, description, location ON events BEGIN
+			UPDATE search_fts SET title = new.title, body = new.description, location = new.location
+			WHERE rowid = 2 * new.id + 1;
+		END;
+
+		INSERT INTO search_fts(rowid, kind, title, body, location)
+			SELECT 2 * id, 'post', title, body, '' FROM posts;
+		INSERT INTO search_fts(rowid, kind, title, body, location)
+			SELECT 2 * id + 1, 'event', title, description, location FROM events;`),
+		down: execSQL(`
+		DROP TRIGGER search_posts_ai;
+		DROP TRIGGER search_posts_ad;
+		DROP TRIGGER search_posts_au;
+		DROP TRIGGER search_events_ai;
+		DROP TRIGGER search_events_ad;
+		DROP TRIGGER search_events_au;
+		DROP TABLE search_fts;`),
+	},
+	{
+		// Failed logins are counted per account and client IP instead of
+		// per account, so guessing from one address can't lock the owner
+		// out everywhere. Counts in progress are dropped.
+		version: 23,
+		name:    "add_login_failures",
+		up: execSQL(`
+		CREATE TABLE login_failures (
+			user_id        INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			ip             TEXT     NOT NULL,
+			failures       INTEGER  NOT NULL DEFAULT 0,
+			locked_until   DATETIME,
+			last_failed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, ip)
+		);
+		ALTER TABLE users DROP COLUMN locked_until;
+		ALTER TABLE users DROP COLUMN failed_logins;`),
+		down: execSQL(`
+		ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE users ADD COLUMN locked_until DATETIME;
+		DROP TABLE login_failures;`),
+	},
+}
+
+// hashSessionTokens is migration 19's up step. SQLite has no SHA-256, so the
+// rows are copied across and their tokens hashed here.
+func hashSessionTokens(tx *sql.Tx) error {
+	if _, err := tx.Exec(`
+		CREATE TABLE sessions_new (
+			id             INTEGER  PRIMARY KEY AUTOINCREMENT,
+			token_hash     TEXT     NOT NULL UNIQUE,
+			user_id        INTEGER  NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent     TEXT     NOT NULL DEFAULT '',
+			ip             TEXT     NOT NULL DEFAULT '',
+			created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at     DATETIME NOT NULL,
+			idle_timeout   INTEGER  NOT NULL DEFAULT 0,
+			max_expires_at DATETIME NOT NULL
+		);
+		INSERT INTO sessions_new (id, token_hash, user_id, user_agent, ip, created_at, last_seen_at, expires_at, max_expires_at)
+			SELECT id, token, user_id, user_agent, ip, created_at, last_seen_at, expires_at, expires_at FROM sessions;
+		DROP TABLE sessions;
+		ALTER TABLE sessions_new RENAME TO sessions;
+		CREATE INDEX idx_sessions_user ON sessions(user_id);`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, token_hash FROM sessions")
+	if err != nil {
+		return err
+	}
+	tokens := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var token string
+		if err := rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens[id] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, token := range tokens {
+		if _, err := tx.Exec("UPDATE sessions SET token_hash = ? WHERE id = ?", hashToken(token), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether table has a column with the given name.
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRow(
+		"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// ensureMigrationsTable creates the table that records applied versions.
+// applied_seq numbers migrations in the order they were applied, which
+// differs from version order when an fts migration was held back (see
+// MigrateUp). Tables from before it existed get it filled in from version.
+func ensureMigrationsTable(db *sql.DB) error {
+	const schemaMigrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version     INTEGER  PRIMARY KEY,
+		name        TEXT     NOT NULL,
+		applied_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		applied_seq INTEGER  NOT NULL DEFAULT 0
+	);`
+
+	if _, err := db.Exec(schemaMigrationsTable); err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+
+	var hasSeq int
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM pragma_table_info('schema_migrations') WHERE name = 'applied_seq'",
+	).Scan(&hasSeq); err != nil {
+		return fmt.Errorf("check schema_migrations table: %w", err)
+	}
+	if hasSeq == 0 {
+		if _, err := db.Exec(`
+			ALTER TABLE schema_migrations ADD COLUMN applied_seq INTEGER NOT NULL DEFAULT 0;
+			UPDATE schema_migrations SET applied_seq = version;`); err != nil {
+			return fmt.Errorf("add applied_seq to schema_migrations: %w", err)
+		}
+	}
+	return nil
+}
+
+// MigrationStatus lists every known migration with its applied time.
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		st := MigrationState{Version: m.version, Name: m.name}
+		if at, ok := applied[m.version]; ok {
+			st.AppliedAt = &at
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+// MigrateUp applies all pending migrations in order and returns how many ran.
+// It stops at the first failure; earlier migrations stay applied.
+//
+// Migrations marked fts need SQLite with FTS5, which go-sqlite3 only
+// compiles in with the sqlite_fts5 build tag. Without it they are left
+// pending, and later ones still run, so the app works without search until
+// a build with the tag applies them. That can apply migrations out of
+// version order, so MigrateDown goes by the order they were applied in.
+// fts migrations must therefore only touch their own tables. A database
+// where one is already applied can't be used without FTS5 at all, and
+// MigrateUp returns ErrNoFTS.
+func MigrateUp(db *sql.DB) (int, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	fts := ftsAvailable(db)
+	if !fts {
+		for i, st := range states {
+			if st.AppliedAt != nil && migrations[i].fts {
+				return 0, fmt.Errorf("migration %d (%s): %w", st.Version, st.Name, ErrNoFTS)
+			}
+		}
+	}
+
+	n := 0
+	for i, st := range states {
+		if st.AppliedAt != nil {
+			continue
+		}
+		m := migrations[i]
+		if m.fts && !fts {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`
+				INSERT INTO schema_migrations (version, name, applied_seq)
+				VALUES (?, ?, (SELECT COALESCE(MAX(applied_seq), 0) + 1 FROM schema_migrations))`,
+				m.version, m.name,
+			)
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// MigrateDown reverts the most recently applied migration and returns its
+// state. It returns nil, nil if nothing is applied.
+func MigrateDown(db *sql.DB) (*MigrationState, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	index := map[int]int{}
+	for i, m := range migrations {
+		index[m.version] = i
+	}
+
+	// Applied order, not version order: see MigrateUp.
+	rows, err := db.Query("SELECT version FROM schema_migrations ORDER BY applied_seq DESC, version DESC")
+	if err != nil {
+		return nil, err
+	}
+	last := -1
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := index[version]; ok {
+			last = i
+			break
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if last < 0 {
+		return nil, nil
+	}
+
+	m := migrations[last]
+	if m.down == nil {
+		return nil, fmt.Errorf("migration %d (%s): %w", m.version, m.name, ErrIrreversible)
+	}
+	err = inTx(db, func(tx *sql.Tx) error {
+		if err := m.down(tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.version)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	return &states[last], nil
+}
+
+// inTx runs fn inside a transaction, committing on success.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// schemaSQL returns the definition of every table, index and trigger, by name.
+func schemaSQL(tb testing.TB, database *sql.DB) map[string]string {
+	tb.Helper()
+	rows, err := database.Query("SELECT name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		tb.Fatalf("read schema: %v", err)
+	}
+	defer rows.Close()
+	schema := map[string]string{}
+	for rows.Next() {
+		var name, def string
+		if err := rows.Scan(&name, &def); err != nil {
+			tb.Fatalf("read schema: %v", err)
+		}
+		schema[name] = def
+	}
+	if err := rows.Err(); err != nil {
+		tb.Fatalf("read schema: %v", err)
+	}
+	return schema
+}
+
+// appliedVersions returns the set of applied migration versions.
+func appliedVersions(tb testing.TB, database *sql.DB) map[int]bool {
+	tb.Helper()
+	states, err := MigrationStatus(database)
+	if err != nil {
+		tb.Fatalf("MigrationStatus: %v", err)
+	}
+	applied := map[int]bool{}
+	for _, st := range states {
+		if st.AppliedAt != nil {
+			applied[st.Version] = true
+		}
+	}
+	return applied
+}
+
+// TestMigrateRoundTrip reverts every reversible migration, newest first,
+// then applies them again and expects the schema it started with.
+func TestMigrateRoundTrip(t *testing.T) {
+	database := openTestDB(t)
+	want := schemaSQL(t, database)
+
+	var reverted []int
+	for range migrations {
+		st, err := MigrateDown(database)
+		if errors.Is(err, ErrIrreversible) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("MigrateDown after reverting %v: %v", reverted, err)
+		}
+		if st == nil {
+			break
+		}
+		if n := len(reverted); n > 0 && st.Version > reverted[n-1] {
+			t.Errorf("reverted %d after %d", st.Version, reverted[n-1])
+		}
+		if appliedVersions(t, database)[st.Version] {
+			t.Errorf("migration %d still applied after MigrateDown", st.Version)
+		}
+		reverted = append(reverted, st.Version)
+	}
+	if len(reverted) == 0 {
+		t.Fatal("no migration could be reverted")
+	}
+
+	n, err := MigrateUp(database)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if n != len(reverted) {
+		t.Errorf("MigrateUp applied %d migrations, want %d", n, len(reverted))
+	}
+
+	got := schemaSQL(t, database)
+	for name, def := range want {
+		if got[name] != def {
+			t.Errorf("%s after round trip:\n%s\nwant:\n%s", name, got[name], def)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s left over after round trip", name)
+		}
+	}
+}
+
+// TestMigrateDownFollowsAppliedOrder checks that MigrateDown reverts
+// migrations in the order they were applied, which is not version order when
+// an fts migration was held back and applied later.
+func TestMigrateDownFollowsAppliedOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int // applied last, in this order
+		want    []int // reverted by successive MigrateDown calls
+	}{
+		{"version order", []int{20, 21}, []int{21, 20}},
+		{"held back", []int{21, 20}, []int{20, 21}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openTestDB(t)
+			// Drop anything applied after them, then replay their order.
+			for {
+				var latest int
+				if err := database.QueryRow(
+					"SELECT version FROM schema_migrations ORDER BY applied_seq DESC LIMIT 1",
+				).Scan(&latest); err != nil {
+					t.Fatalf("latest migration: %v", err)
+				}
+				if latest <= 21 {
+					break
+				}
+				if _, err := MigrateDown(database); err != nil {
+					t.Fatalf("MigrateDown: %v", err)
+				}
+			}
+			for _, v := range tt.applied {
+				if _, err := database.Exec(
+					"UPDATE schema_migrations SET applied_seq = (SELECT MAX(applied_seq) + 1 FROM schema_migrations) WHERE version = ?", v,
+				); err != nil {
+					t.Fatalf("reorder migration %d: %v", v, err)
+				}
+			}
+
+			for _, want := range tt.want {
+				st, err := MigrateDown(database)
+				if err != nil {
+					t.Fatalf("MigrateDown: %v", err)
+				}
+				if st == nil || st.Version != want {
+					t.Fatalf("MigrateDown reverted %+v, want version %d", st, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateUpFTS(t *testing.T) {
+	const searchIndex = 22 // create_search_index, the fts migration
+	database := openTestDB(t)
+	applied := appliedVersions(t, database)
+
+	if ftsAvailable(database) {
+		if !applied[searchIndex] {
+			t.Errorf("migration %d pending with FTS5 available", searchIndex)
+		}
+		return
+	}
+
+	// Without FTS5 the search index is skipped and later migrations run.
+	if applied[searchIndex] {
+		t.Errorf("migration %d applied without FTS5", searchIndex)
+	}
+	if last := migrations[len(migrations)-1].version; !applied[last] {
+		t.Errorf("migration %d after the skipped fts migration is pending", last)
+	}
+
+	// A database that has the index can't be opened without FTS5.
+	if _, err := database.Exec(
+		"INSERT INTO schema_migrations (version, name) VALUES (?, 'create_search_index')", searchIndex,
+	); err != nil {
+		t.Fatalf("mark migration applied: %v", err)
+	}
+	if _, err := MigrateUp(database); !errors.Is(err, ErrNoFTS) {
+		t.Errorf("MigrateUp error = %v, want ErrNoFTS", err)
+	}
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Roles a user can hold.
+const (
+	RoleVillager = "villager"
+	RoleAdmin    = "admin"
+)
+
+// ErrInvalidRole is returned when setting a role other than RoleVillager or RoleAdmin.
+var ErrInvalidRole = errors.New("invalid role")
+
+// ModerationEntry represents a row in the moderation_log table.
+type ModerationEntry struct {
+	ID         int64     `json:"id"`
+	AdminID    *int64    `json:"admin_id"`   // nil if the admin's account was deleted
+	AdminName  *string   `json:"admin_name"` // populated from LEFT JOIN
+	Action     string    `json:"action"`     // e.g. delete_post, hide_event, suspend_user, promote_user
+	TargetType string    `json:"target_type"`
+	TargetID   int64     `json:"target_id"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// moderate runs one moderation change and logs it in the same transaction.
+// The change must affect exactly the target row; if it affects none,
+// ErrNotFound is returned and nothing is logged.
+func moderate(db *sql.DB, adminID int64, action, targetType string, targetID int64, reason string,
+	change func(tx *sql.Tx) (sql.Result, error)) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := change(tx)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO moderation_log (admin_id, action, target_type, target_id, reason) VALUES (?, ?, ?, ?, ?)",
+		adminID, action, targetType, targetID, reason,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ModerateDeletePost deletes any post. Returns ErrNotFound if it doesn't exist.
+func ModerateDeletePost(db *sql.DB, adminID, postID int64, reason string) error {
+	return moderate(db, adminID, "delete_post", "post", postID, reason, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec("DELETE FROM posts WHERE id = ?", postID)
+	})
+}
+
+// ModerateDeleteEvent deletes any event. Returns ErrNotFound if it doesn't exist.
+func ModerateDeleteEvent(db *sql.DB, adminID, eventID int64, reason string) error {
+	return moderate(db, adminID, "delete_event", "event", eventID, reason, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec("DELETE FROM events WHERE id = ?", eventID)
+	})
+}
+
+// ModerateHidePost hides (or, with hidden=false, restores) a post. Hidden
+// posts are left out of lists and search and are only visible to their author
+// and admins. Returns ErrNotFound if the post doesn't exist.
+func ModerateHidePost(db *sql.DB, adminID, postID int64, hidden bool, reason string) error {
+	action := "hide_post"
+	if !hidden {
+		action = "unhide_post"
+	}
+	return moderate(db, adminID, action, "post", postID, reason, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec("UPDATE posts SET hidden_at = CASE WHEN ? THEN CURRENT_TIMESTAMP END WHERE id = ?", hidden, postID)
+	})
+}
+
+// ModerateHideEvent hides (or restores) an event, like ModerateHidePost.
+func ModerateHideEvent(db *sql.DB, adminID, eventID int64, hidden bool, reason string) error {
+	action := "hide_event"
+	if !hidden {
+		action = "unhide_event"
+	}
+	return moderate(db, adminID, action, "event", eventID, reason, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec("UPDATE events SET hidden_at = CASE WHEN ? THEN CURRENT_TIMESTAMP END WHERE id = ?", hidden, eventID)
+	})
+}
+
+// ModerateSuspendUser suspends (or reinstates) an account. Suspending also
+// deletes all of the user's sessions, logging them out everywhere.
+// Returns ErrNotFound if the user doesn't exist.
+func ModerateSuspendUser(db *sql.DB, adminID, userID int64, suspended bool, reason string) error {
+	action := "suspend_user"
+	if !suspended {
+		action = "unsuspend_user"
+	}
+	return moderate(db, adminID, action, "user", userID, reason, func(tx *sql.Tx) (sql.Result, error) {
+		if suspended {
+			if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+				return nil, err
+			}
+		}
+		return tx.Exec("UPDATE users SET suspended_at = CASE WHEN ? THEN CURRENT_TIMESTAMP END WHERE id = ?", suspended, userID)
+	})
+}
+
+// ModerateSetRole promotes or demotes a user. Returns ErrInvalidRole for
+// unknown roles and ErrNotFound if the user doesn't exist.
+func ModerateSetRole(db *sql.DB, adminID, userID int64, role, reason string) error {
+	if role != RoleVillager && role != RoleAdmin {
+		return ErrInvalidRole
+	}
+	action := "promote_user"
+	if role == RoleVillager {
+		action = "demote_user"
+	}
+	return moderate(db, adminID, action, "user", userID, reason, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	})
+}
+
+// ListModerationLog returns the most recent moderation actions, newest first.
+func ListModerationLog(db *sql.DB, limit int) ([]ModerationEntry, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.admin_id, u.name, m.action, m.target_type, m.target_id, m.reason, m.created_at
+		FROM moderation_log m
+		LEFT JOIN users u ON u.id = m.admin_id
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ?`, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ModerationEntry{}
+	for rows.Next() {
+		var e ModerationEntry
+		if err := rows.Scan(&e.ID, &e.AdminID, &e.AdminName, &e.Action, &e.TargetType, &e.TargetID, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidCursor is returned by ParseCursor for malformed cursor strings.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorTimeFormat matches what SQLite's datetime() returns, so a cursor can be
+// compared directly against datetime(column) in keyset conditions.
+const cursorTimeFormat = "2006-01-02 15:04:05"
+
+// Cursor marks a position in a keyset-paginated list: the sort time and ID of
+// the last row on the previous page.
+type Cursor struct {
+	Time time.Time
+	ID   int64
+}
+
+// String encodes the cursor as an opaque, URL-safe token.
+func (c Cursor) String() string {
+	raw := fmt.Sprintf("%d:%d", c.Time.Unix(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// sqlTime returns the cursor time in the format produced by datetime().
+func (c Cursor) sqlTime() string {
+	return c.Time.UTC().Format(cursorTimeFormat)
+}
+
+// ParseCursor decodes a token produced by Cursor.String.
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var unix, id int64
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &unix, &id); err != nil || id <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{Time: time.Unix(unix, 0).UTC(), ID: id}, nil
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -13,17 +15,50 @@ var ErrNotFound = errors.New("not found")
 // Post represents a row in the posts table.
 type Post struct {
 	ID             int64     `json:"id"`
-	UserID         int64     `json:"user_id"`
-	Author         string    `json:"author"` // populated from JOIN, not stored in posts table
-	Type           string    `json:"type"`   // offer | request | announcement
+	UserID         int64     `json:"user_id"` // the author; their profile is at /api/users/{id}
+	Author         string    `json:"author"`  // populated from JOIN, not stored in posts table
+	AuthorAvatar   string    `json:"author_avatar"`
+	Type           string    `json:"type"` // offer | request | announcement
 	Title          string    `json:"title"`
 	Body           string    `json:"body"`
 	Category       string    `json:"category"`
-	EventID        *int64    `json:"event_id"`    // nullable FK to events
-	EventTitle     *string   `json:"event_title"` // populated from LEFT JOIN to events
+	EventID        *int64    `json:"event_id"`      // nullable FK to events
+	EventTitle     *string   `json:"event_title"`   // populated from LEFT JOIN to events
+	EventChanged   bool      `json:"event_changed"` // linked event's time was edited
 	CreatedAt      time.Time `json:"created_at"`
 	InterestCount  int       `json:"interest_count"`
 	UserInterested bool      `json:"user_interested"`
+	Status         string    `json:"status"` // available, reserved, completed or expired
+	Hidden         bool      `json:"hidden"` // hidden by a moderator
+}
+
+// eventChangedColumn reports whether the linked event's time has been edited,
+// so posts can flag that the event they point to has moved.
+const eventChangedColumn = `EXISTS(SELECT 1 FROM event_changes c
+		           WHERE c.event_id = p.event_id AND c.field IN ('start_time', 'end_time'))`
+
+// postColumns and postJoins make up postSelect, the SELECT shared by post
+// queries; queries that start from another table use them directly. Interest
+// data is computed per row in SQL rather than with follow-up queries. The
+// single placeholder is the caller's user ID for user_interested; 0 matches
+// no one.
+const (
+	postColumns = `p.id, p.user_id, u.name, u.avatar, p.type, p.title, p.body, p.category, p.event_id, e.title, p.created_at,
+		       ` + eventChangedColumn + `,
+		       (SELECT COUNT(*) FROM interests i WHERE i.post_id = p.id),
+		       EXISTS(SELECT 1 FROM interests i WHERE i.post_id = p.id AND i.user_id = ?),
+		       p.status,
+		       p.hidden_at IS NOT NULL`
+	postJoins = `JOIN users u ON u.id = p.user_id
+		LEFT JOIN events e ON e.id = p.event_id`
+	postSelect = "SELECT " + postColumns + " FROM posts p " + postJoins
+)
+
+// scanPost scans a row selected with postColumns into p, followed by any
+// extra columns into extra.
+func scanPost(row interface{ Scan(...any) error }, p *Post, extra ...any) error {
+	return row.Scan(append([]any{&p.ID, &p.UserID, &p.Author, &p.AuthorAvatar, &p.Type, &p.Title, &p.Body, &p.Category, &p.EventID, &p.EventTitle, &p.CreatedAt,
+		&p.EventChanged, &p.InterestCount, &p.UserInterested, &p.Status, &p.Hidden}, extra...)...)
 }
 
 // CreatePost inserts a new post and returns it with the author name populated.
@@ -49,57 +84,98 @@ func CreatePost(db *sql.DB, userID int64, postType, title, body, category string
 // callerUserID is used to populate UserInterested; pass 0 for unauthenticated requests.
 func GetPostByID(db *sql.DB, id int64, callerUserID int64) (*Post, error) {
 	p := &Post{}
-	err := db.QueryRow(`
-		SELECT p.id, p.user_id, u.name, p.type, p.title, p.body, p.category, p.event_id, e.title, p.created_at
-		FROM posts p
-		JOIN users u ON u.id = p.user_id
-		LEFT JOIN events e ON e.id = p.event_id
-		WHERE p.id = ?`, id,
-	).Scan(&p.ID, &p.UserID, &p.Author, &p.Type, &p.Title, &p.Body, &p.Category, &p.EventID, &p.EventTitle, &p.CreatedAt)
-	if err != nil {
+	if err := scanPost(db.QueryRow(postSelect+" WHERE p.id = ?", callerUserID, id), p); err != nil {
 		return nil, err
 	}
-
-	p.InterestCount, err = GetInterestCount(db, p.ID)
-	if err != nil {
-		return nil, err
-	}
-	if callerUserID > 0 {
-		p.UserInterested, err = HasUserInterest(db, p.ID, callerUserID)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	return p, nil
 }
 
-// ListPosts returns posts ordered by created_at DESC, optionally filtered by type and/or category.
-// callerUserID is used to populate UserInterested; pass 0 for unauthenticated requests.
-func ListPosts(db *sql.DB, postType, category string, callerUserID int64) ([]Post, error) {
-	query := `SELECT p.id, p.user_id, u.name, p.type, p.title, p.body, p.category, p.event_id, e.title, p.created_at
-		FROM posts p
-		JOIN users u ON u.id = p.user_id
-		LEFT JOIN events e ON e.id = p.event_id`
+// PostFilter narrows ListPosts and CountPosts. Empty fields don't filter,
+// except Status: empty means the open statuses (available and reserved), and
+// StatusAll matches every status. Posts hidden by a moderator are always left
+// out.
+type PostFilter struct {
+	Type     string
+	Category string
+	Status   string
+}
 
-	var conditions []string
+// where returns the SQL conditions and arguments for the filter, for use
+// against "posts p".
+func (f PostFilter) where() ([]string, []any) {
+	conditions := []string{"p.hidden_at IS NULL"}
 	var args []any
 
-	if postType != "" {
+	if f.Type != "" {
 		conditions = append(conditions, "p.type = ?")
-		args = append(args, postType)
+		args = append(args, f.Type)
 	}
-	if category != "" {
+	if f.Category != "" {
 		conditions = append(conditions, "p.category = ?")
-		args = append(args, category)
+		args = append(args, f.Category)
+	}
+	switch f.Status {
+	case "":
+		conditions = append(conditions, "p.status IN ('available', 'reserved')")
+	case StatusAll:
+	default:
+		conditions = append(conditions, "p.status = ?")
+		args = append(args, f.Status)
 	}
+	return conditions, args
+}
 
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
+// ListPosts returns up to limit posts ordered by created_at DESC, starting
+// after the given cursor (nil for the first page). The returned cursor points
+// at the next page and is nil when there are no more posts.
+// callerUserID is used to populate UserInterested; pass 0 for unauthenticated requests.
+func ListPosts(db *sql.DB, filter PostFilter, callerUserID int64, limit int, after *Cursor) ([]Post, *Cursor, error) {
+	query := postSelect
+
+	conditions, args := filter.where()
+	args = append([]any{callerUserID}, args...)
+	if after != nil {
+		conditions = append(conditions, "(datetime(p.created_at), p.id) < (?, ?)")
+		args = append(args, after.sqlTime(), after.ID)
 	}
-	query += " ORDER BY p.created_at DESC"
+
+	query += " WHERE " + strings.Join(conditions, " AND ")
+	// Fetch one extra row to learn whether another page follows.
+	query += " ORDER BY datetime(p.created_at) DESC, p.id DESC LIMIT ?"
+	args = append(args, limit+1)
 
 	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		if err := scanPost(rows, &p); err != nil {
+			return nil, nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		next = &Cursor{Time: last.CreatedAt, ID: last.ID}
+	}
+
+	return posts, next, nil
+}
+
+// ListUserPosts returns every post the user wrote, in any status and hidden
+// or not, newest first.
+func ListUserPosts(db *sql.DB, userID int64) ([]Post, error) {
+	rows, err := db.Query(postSelect+" WHERE p.user_id = ? ORDER BY datetime(p.created_at) DESC, p.id DESC", userID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -108,29 +184,78 @@ func ListPosts(db *sql.DB, postType, category string, callerUserID int64) ([]Pos
 	posts := []Post{}
 	for rows.Next() {
 		var p Post
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Author, &p.Type, &p.Title, &p.Body, &p.Category, &p.EventID, &p.EventTitle, &p.CreatedAt); err != nil {
+		if err := scanPost(rows, &p); err != nil {
 			return nil, err
 		}
 		posts = append(posts, p)
 	}
-	if err := rows.Err(); err != nil {
+	return posts, rows.Err()
+}
+
+// CountPosts returns the number of posts matching the filter, across all pages.
+func CountPosts(db *sql.DB, filter PostFilter) (int, error) {
+	conditions, args := filter.where()
+	query := "SELECT COUNT(*) FROM posts p WHERE " + strings.Join(conditions, " AND ")
+
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// UpdatePost replaces the editable fields of a post owned by userID. The
+// previous version is saved to post_revisions in the same transaction; if
+// nothing changed, no revision is recorded. Returns ErrNotFound if the post
+// doesn't exist or doesn't belong to the user.
+func UpdatePost(db *sql.DB, postID, userID int64, title, body, category string, eventID *int64) (*Post, error) {
+	tx, err := db.Begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	for i := range posts {
-		posts[i].InterestCount, err = GetInterestCount(db, posts[i].ID)
-		if err != nil {
+	var old PostRevision
+	err = tx.QueryRow(
+		"SELECT title, body, category, event_id FROM posts WHERE id = ? AND user_id = ?",
+		postID, userID,
+	).Scan(&old.Title, &old.Body, &old.Category, &old.EventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changed := old.Title != title || old.Body != body || old.Category != category ||
+		!equalPtr(old.EventID, eventID)
+
+	if changed {
+		if _, err := tx.Exec(
+			"INSERT INTO post_revisions (post_id, title, body, category, event_id) VALUES (?, ?, ?, ?, ?)",
+			postID, old.Title, old.Body, old.Category, old.EventID,
+		); err != nil {
 			return nil, err
 		}
-		if callerUserID > 0 {
-			posts[i].UserInterested, err = HasUserInterest(db, posts[i].ID, callerUserID)
-			if err != nil {
-				return nil, err
-			}
+		if _, err := tx.Exec(
+			"UPDATE posts SET title = ?, body = ?, category = ?, event_id = ? WHERE id = ?",
+			title, body, category, eventID, postID,
+		); err != nil {
+			return nil, err
 		}
 	}
 
-	return posts, nil
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetPostByID(db, postID, userID)
+}
+
+// equalPtr reports whether two nullable values are equal.
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 // DeletePost deletes a post only if it belongs to the given user.
@@ -149,3 +274,135 @@ func DeletePost(db *sql.DB, postID, userID int64) error {
 	}
 	return nil
 }
+
+// Post statuses. StatusAll is only a filter value for PostFilter.
+const (
+	StatusAvailable = "available"
+	StatusReserved  = "reserved"
+	StatusCompleted = "completed"
+	StatusExpired   = "expired"
+	StatusAll       = "all"
+)
+
+// ErrInvalidTransition is returned when a post can't move from its current
+// status to the requested one.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// statusTransitions lists the statuses each status may move to. Completed is
+// final; an expired post can be relisted.
+var statusTransitions = map[string][]string{
+	StatusAvailable: {StatusReserved, StatusCompleted, StatusExpired},
+	StatusReserved:  {StatusAvailable, StatusCompleted},
+	StatusExpired:   {StatusAvailable},
+	StatusCompleted: {},
+}
+
+// ValidPostStatus reports whether s is a real post status.
+func ValidPostStatus(s string) bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// canTransition reports whether a post may move from one status to another.
+func canTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPostStatus moves a post owned by userID to a new status. Moving a
+// reserved post back to available also drops the chosen interest. Returns
+// ErrNotFound if the post doesn't exist or isn't the user's, and
+// ErrInvalidTransition if the move isn't allowed.
+func SetPostStatus(db *sql.DB, postID, userID int64, status string) (*Post, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow("SELECT status FROM posts WHERE id = ? AND user_id = ?", postID, userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canTransition(current, status) {
+		return nil, ErrInvalidTransition
+	}
+
+	if err := setStatus(tx, postID, status); err != nil {
+		return nil, err
+	}
+	if status == StatusAvailable {
+		if _, err := tx.Exec("UPDATE interests SET chosen_at = NULL WHERE post_id = ?", postID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetPostByID(db, postID, userID)
+}
+
+// setStatus writes a post's status and when it changed.
+func setStatus(tx *sql.Tx, postID int64, status string) error {
+	_, err := tx.Exec(
+		"UPDATE posts SET status = ?, status_changed_at = CURRENT_TIMESTAMP WHERE id = ?", status, postID,
+	)
+	return err
+}
+
+// ExpiryRule sets how long posts of a type stay available before they
+// expire. A rule with a Category applies only to that category and takes
+// precedence over the type-wide rule.
+type ExpiryRule struct {
+	Type     string
+	Category string // empty for every category without its own rule
+	TTL      time.Duration
+}
+
+// ExpirePosts moves available posts older than their rule's TTL to expired.
+// Age counts from the last status change, so relisted posts get a fresh
+// period. Reserved posts never expire, and posts without a rule are kept.
+// Returns the number of posts expired. Cancelling ctx stops the run; posts
+// expired by then stay expired.
+func ExpirePosts(ctx context.Context, db *sql.DB, rules []ExpiryRule) (int64, error) {
+	var total int64
+	for _, rule := range rules {
+		query := `UPDATE posts SET status = ?, status_changed_at = CURRENT_TIMESTAMP
+			WHERE status = ? AND type = ?
+			AND datetime(COALESCE(status_changed_at, created_at)) <= datetime('now', ?)`
+		args := []any{StatusExpired, StatusAvailable, rule.Type, fmt.Sprintf("-%d seconds", int64(rule.TTL.Seconds()))}
+
+		if rule.Category != "" {
+			query += " AND category = ?"
+			args = append(args, rule.Category)
+		} else {
+			// Leave categories with their own rule to that rule.
+			for _, other := range rules {
+				if other.Type == rule.Type && other.Category != "" {
+					query += " AND category != ?"
+					args = append(args, other.Category)
+				}
+			}
+		}
+
+		res, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB initialises a fresh database in a temporary directory.
+func openTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	database, err := Init(filepath.Join(tb.TempDir(), "test.db"))
+	if err != nil {
+		tb.Fatalf("init db: %v", err)
+	}
+	tb.Cleanup(func() { database.Close() })
+	return database
+}
+
+// createTestUser inserts a user and returns its ID.
+func createTestUser(tb testing.TB, database *sql.DB, email string) int64 {
+	tb.Helper()
+	res, err := database.Exec(
+		"INSERT INTO users (name, email, password) VALUES (?, ?, ?)", email, email, "x",
+	)
+	if err != nil {
+		tb.Fatalf("insert user: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// seedFeed inserts n offers by author, each with one interest from fan.
+func seedFeed(tb testing.TB, database *sql.DB, n int, author, fan int64) {
+	tb.Helper()
+	tx, err := database.Begin()
+	if err != nil {
+		tb.Fatalf("begin: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		res, err := tx.Exec(
+			"INSERT INTO posts (user_id, type, title, category) VALUES (?, 'offer', ?, 'fish')",
+			author, fmt.Sprintf("Herring #%d", i),
+		)
+		if err != nil {
+			tb.Fatalf("insert post: %v", err)
+		}
+		postID, _ := res.LastInsertId()
+		if _, err := tx.Exec("INSERT INTO interests (post_id, user_id) VALUES (?, ?)", postID, fan); err != nil {
+			tb.Fatalf("insert interest: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tb.Fatalf("commit: %v", err)
+	}
+}
+
+func TestListPostsInterestFields(t *testing.T) {
+	database := openTestDB(t)
+	author := createTestUser(t, database, "jan@village.nl")
+	fan := createTestUser(t, database, "maria@village.nl")
+	other := createTestUser(t, database, "pieter@village.nl")
+	seedFeed(t, database, 3, author, fan)
+
+	posts, _, err := ListPosts(database, PostFilter{}, fan, 10, nil)
+	if err != nil {
+		t.Fatalf("ListPosts: %v", err)
+	}
+	for _, p := range posts {
+		if p.InterestCount != 1 || !p.UserInterested {
+			t.Errorf("post %d as fan: count=%d interested=%v, want 1 true", p.ID, p.InterestCount, p.UserInterested)
+		}
+	}
+
+	posts, _, err = ListPosts(database, PostFilter{}, other, 10, nil)
+	if err != nil {
+		t.Fatalf("ListPosts: %v", err)
+	}
+	for _, p := range posts {
+		if p.InterestCount != 1 || p.UserInterested {
+			t.Errorf("post %d as other: count=%d interested=%v, want 1 false", p.ID, p.InterestCount, p.UserInterested)
+		}
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusAvailable, StatusReserved, true},
+		{StatusAvailable, StatusCompleted, true},
+		{StatusAvailable, StatusExpired, true},
+		{StatusAvailable, StatusAvailable, false},
+		{StatusReserved, StatusAvailable, true},
+		{StatusReserved, StatusCompleted, true},
+		{StatusReserved, StatusExpired, false},
+		{StatusReserved, StatusReserved, false},
+		{StatusExpired, StatusAvailable, true},
+		{StatusExpired, StatusReserved, false},
+		{StatusExpired, StatusCompleted, false},
+		{StatusCompleted, StatusAvailable, false},
+		{StatusCompleted, StatusReserved, false},
+		{StatusCompleted, StatusExpired, false},
+		{"sold", StatusAvailable, false},
+		{StatusAvailable, "sold", false},
+	}
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestSetPostStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		owner   bool
+		wantErr error
+	}{
+		{"reserve", StatusAvailable, StatusReserved, true, nil},
+		{"complete reserved", StatusReserved, StatusCompleted, true, nil},
+		{"release reservation", StatusReserved, StatusAvailable, true, nil},
+		{"relist expired", StatusExpired, StatusAvailable, true, nil},
+		{"reopen completed", StatusCompleted, StatusAvailable, true, ErrInvalidTransition},
+		{"reserve expired", StatusExpired, StatusReserved, true, ErrInvalidTransition},
+		{"unknown status", StatusAvailable, "sold", true, ErrInvalidTransition},
+		{"not the author", StatusAvailable, StatusReserved, false, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openTestDB(t)
+			author := createTestUser(t, database, "jan@village.nl")
+			fan := createTestUser(t, database, "maria@village.nl")
+			seedFeed(t, database, 1, author, fan)
+
+			const postID = 1
+			if _, err := database.Exec("UPDATE posts SET status = ? WHERE id = ?", tt.from, postID); err != nil {
+				t.Fatalf("set status: %v", err)
+			}
+			if _, err := database.Exec("UPDATE interests SET chosen_at = CURRENT_TIMESTAMP WHERE post_id = ?", postID); err != nil {
+				t.Fatalf("choose interest: %v", err)
+			}
+
+			caller := author
+			if !tt.owner {
+				caller = fan
+			}
+			post, err := SetPostStatus(database, postID, caller, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetPostStatus error = %v, want %v", err, tt.wantErr)
+			}
+
+			want := tt.to
+			if tt.wantErr != nil {
+				want = tt.from
+			} else if post.Status != tt.to {
+				t.Errorf("returned status %q, want %q", post.Status, tt.to)
+			}
+			var status string
+			var chosen int
+			if err := database.QueryRow(`
+				SELECT p.status, (SELECT COUNT(*) FROM interests WHERE post_id = p.id AND chosen_at IS NOT NULL)
+				FROM posts p WHERE p.id = ?`, postID,
+			).Scan(&status, &chosen); err != nil {
+				t.Fatalf("read post: %v", err)
+			}
+			if status != want {
+				t.Errorf("stored status %q, want %q", status, want)
+			}
+			// Moving back to available drops the chosen interest.
+			released := tt.wantErr == nil && tt.to == StatusAvailable
+			if wantChosen := !released; (chosen == 1) != wantChosen {
+				t.Errorf("chosen interests = %d, want chosen %v", chosen, wantChosen)
+			}
+		})
+	}
+}
+
+// BenchmarkListPosts loads one feed page from tables of increasing size. The
+// time per op should stay roughly flat: interest data comes from the main
+// query, and the feed index avoids sorting the whole table.
+func BenchmarkListPosts(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("posts=%d", n), func(b *testing.B) {
+			database := openTestDB(b)
+			author := createTestUser(b, database, "jan@village.nl")
+			fan := createTestUser(b, database, "maria@village.nl")
+			seedFeed(b, database, n, author, fan)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := ListPosts(database, PostFilter{}, fan, 50, nil); err != nil {
+					b.Fatalf("ListPosts: %v", err)
+				}
+			}
+		})
+	}
+}
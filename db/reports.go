@@ -0,0 +1,235 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report statuses. New reports are open until a moderator resolves them.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// ErrAlreadyReported is returned when a user reports the same item twice.
+var ErrAlreadyReported = errors.New("already reported")
+
+// ErrInvalidResolution is returned by ResolveReport for statuses other than
+// ReportDismissed or ReportActioned.
+var ErrInvalidResolution = errors.New("invalid resolution")
+
+// Report represents a row in the reports table, with details about the
+// reported item for the moderation queue.
+type Report struct {
+	ID           int64      `json:"id"`
+	ReporterID   int64      `json:"reporter_id"`
+	ReporterName string     `json:"reporter"`    // populated from JOIN
+	TargetType   string     `json:"target_type"` // "post" or "event"
+	TargetID     int64      `json:"target_id"`
+	TargetTitle  string     `json:"target_title"`
+	TargetHidden bool       `json:"target_hidden"`
+	OpenReports  int        `json:"open_reports"` // open reports on the same item
+	Reason       string     `json:"reason"`
+	Status       string     `json:"status"`
+	ResolvedBy   *int64     `json:"resolved_by"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ReportPost records a user's report against a post. Once the post has
+// threshold open reports it is hidden automatically and the action is logged
+// without an admin; threshold <= 0 disables that. Returns ErrAlreadyReported
+// if the user has reported this post before.
+func ReportPost(db *sql.DB, postID, reporterID int64, reason string, threshold int) error {
+	return report(db, "post", postID, reporterID, reason, threshold)
+}
+
+// ReportEvent records a report against an event, like ReportPost.
+func ReportEvent(db *sql.DB, eventID, reporterID int64, reason string, threshold int) error {
+	return report(db, "event", eventID, reporterID, reason, threshold)
+}
+
+// report inserts a report against a post or event and applies the
+// auto-hide threshold in the same transaction.
+func report(db *sql.DB, targetType string, targetID, reporterID int64, reason string, threshold int) error {
+	// targetType is "post" or "event"; the column and table names follow from it.
+	column, table := targetType+"_id", targetType+"s"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO reports (reporter_id, "+column+", reason) VALUES (?, ?, ?)",
+		reporterID, targetID, reason,
+	); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrAlreadyReported
+		}
+		return err
+	}
+
+	if threshold > 0 {
+		var open int
+		if err := tx.QueryRow(
+			"SELECT COUNT(*) FROM reports WHERE "+column+" = ? AND status = 'open'", targetID,
+		).Scan(&open); err != nil {
+			return err
+		}
+		if open >= threshold {
+			res, err := tx.Exec(
+				"UPDATE "+table+" SET hidden_at = CURRENT_TIMESTAMP WHERE id = ? AND hidden_at IS NULL", targetID,
+			)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				if _, err := tx.Exec(
+					"INSERT INTO moderation_log (admin_id, action, target_type, target_id, reason) VALUES (NULL, ?, ?, ?, ?)",
+					"auto_hide_"+targetType, targetType, targetID, fmt.Sprintf("%d open reports", open),
+				); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListReports returns up to limit reports with the given status, oldest
+// first, so the moderation queue is worked through in order.
+func ListReports(db *sql.DB, status string, limit int) ([]Report, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.reporter_id, u.name,
+		       CASE WHEN r.post_id IS NOT NULL THEN 'post' ELSE 'event' END,
+		       COALESCE(r.post_id, r.event_id),
+		       COALESCE(p.title, e.title, ''),
+		       COALESCE(p.hidden_at, e.hidden_at) IS NOT NULL,
+		       (SELECT COUNT(*) FROM reports o
+		        WHERE o.status = 'open' AND (o.post_id = r.post_id OR o.event_id = r.event_id)),
+		       r.reason, r.status, r.resolved_by, r.resolved_at, r.created_at
+		FROM reports r
+		JOIN users u ON u.id = r.reporter_id
+		LEFT JOIN posts p ON p.id = r.post_id
+		LEFT JOIN events e ON e.id = r.event_id
+		WHERE r.status = ?
+		ORDER BY r.created_at ASC, r.id ASC
+		LIMIT ?`, status, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var rp Report
+		if err := rows.Scan(&rp.ID, &rp.ReporterID, &rp.ReporterName, &rp.TargetType, &rp.TargetID,
+			&rp.TargetTitle, &rp.TargetHidden, &rp.OpenReports, &rp.Reason, &rp.Status,
+			&rp.ResolvedBy, &rp.ResolvedAt, &rp.CreatedAt); err != nil {
+			return nil, err
+		}
+		reports = append(reports, rp)
+	}
+	return reports, rows.Err()
+}
+
+// ResolveReport closes an open report as dismissed or actioned. The decision
+// is about the reported item, so every other open report on the same item is
+// closed with it; the action is written to the moderation log. Actioning
+// does not change the item itself — use the hide and delete actions for
+// that. Dismissing restores an item that the report threshold hid, unless a
+// moderator has hidden it since, and reports whether it did.
+// Returns ErrNotFound if there is no open report with that ID.
+func ResolveReport(db *sql.DB, adminID, reportID int64, resolution, reason string) (unhidden bool, err error) {
+	if resolution != ReportDismissed && resolution != ReportActioned {
+		return false, ErrInvalidResolution
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var postID, eventID sql.NullInt64
+	err = tx.QueryRow(
+		"SELECT post_id, event_id FROM reports WHERE id = ? AND status = 'open'", reportID,
+	).Scan(&postID, &eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+
+	targetType, targetID := "post", postID.Int64
+	if eventID.Valid {
+		targetType, targetID = "event", eventID.Int64
+	}
+	column, table := targetType+"_id", targetType+"s"
+	action := "dismiss_reports"
+	if resolution == ReportActioned {
+		action = "action_reports"
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE reports SET status = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP WHERE "+column+" = ? AND status = 'open'",
+		resolution, adminID, targetID,
+	); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO moderation_log (admin_id, action, target_type, target_id, reason) VALUES (?, ?, ?, ?, ?)",
+		adminID, action, targetType, targetID, reason,
+	); err != nil {
+		return false, err
+	}
+
+	if resolution == ReportDismissed {
+		// The latest hide-related entry tells whether the current hide came
+		// from the threshold or from a moderator.
+		var last string
+		err := tx.QueryRow(`
+			SELECT action FROM moderation_log
+			WHERE target_type = ? AND target_id = ? AND action IN (?, ?, ?)
+			ORDER BY id DESC LIMIT 1`,
+			targetType, targetID, "auto_hide_"+targetType, "hide_"+targetType, "unhide_"+targetType,
+		).Scan(&last)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		if last == "auto_hide_"+targetType {
+			res, err := tx.Exec("UPDATE "+table+" SET hidden_at = NULL WHERE id = ? AND hidden_at IS NOT NULL", targetID)
+			if err != nil {
+				return false, err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return false, err
+			}
+			if n > 0 {
+				if _, err := tx.Exec(
+					"INSERT INTO moderation_log (admin_id, action, target_type, target_id, reason) VALUES (?, ?, ?, ?, ?)",
+					adminID, "unhide_"+targetType, targetType, targetID, "reports dismissed",
+				); err != nil {
+					return false, err
+				}
+				unhidden = true
+			}
+		}
+	}
+
+	return unhidden, tx.Commit()
+}
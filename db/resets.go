@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CreatePasswordReset issues a single-use reset token for the user that
+// expires after ttl. Only its hash is stored; the token itself is returned so
+// it can be emailed.
+func CreatePasswordReset(db *sql.DB, userID int64, ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, hashToken(token), time.Now().UTC().Add(ttl),
+	)
+	if err != nil {
+		return "", fmt.Errorf("insert password reset: %w", err)
+	}
+	return token, nil
+}
+
+// ResetPassword redeems a reset token: it sets the user's password hash, lifts
+// any login locks, marks every outstanding reset token for the user as used,
+// and deletes all of the user's sessions. Returns ErrInvalidToken if the token is unknown, expired or
+// already used.
+func ResetPassword(db *sql.DB, token, passwordHash string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`
+		SELECT user_id FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?`,
+		hashToken(token), time.Now().UTC(),
+	).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", passwordHash, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(
+		"UPDATE password_resets SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND used_at IS NULL", userID,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// CleanExpiredPasswordResets deletes reset tokens that can no longer be used.
+// Cancelling ctx abandons the delete.
+func CleanExpiredPasswordResets(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM password_resets WHERE expires_at < ? OR used_at IS NOT NULL", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PostRevision represents a row in the post_revisions table: the state of a
+// post before one of its edits.
+type PostRevision struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"post_id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Category  string    `json:"category"`
+	EventID   *int64    `json:"event_id"`
+	CreatedAt time.Time `json:"created_at"` // when this version was replaced
+}
+
+// ListPostRevisions returns the prior versions of a post, newest first.
+func ListPostRevisions(db *sql.DB, postID int64) ([]PostRevision, error) {
+	rows, err := db.Query(`
+		SELECT id, post_id, title, body, category, event_id, created_at
+		FROM post_revisions
+		WHERE post_id = ?
+		ORDER BY created_at DESC, id DESC`, postID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var r PostRevision
+		if err := rows.Scan(&r.ID, &r.PostID, &r.Title, &r.Body, &r.Category, &r.EventID, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
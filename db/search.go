@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"sort"
+	"strings"
+)
+
+// ErrSearchUnavailable is returned by Search when SQLite was built without
+// FTS5 (go-sqlite3 needs the sqlite_fts5 build tag).
+var ErrSearchUnavailable = errors.New("full-text search unavailable")
+
+// SearchResult is a single ranked hit from Search. Exactly one of Post and
+// Event is set, depending on Kind.
+type SearchResult struct {
+	Kind    string  `json:"kind"`    // post | event
+	Rank    float64 `json:"rank"`    // bm25 score; lower is a better match
+	Snippet string  `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+	Post    *Post   `json:"post,omitempty"`
+	Event   *Event  `json:"event,omitempty"`
+}
+
+// Sentinels that snippet() wraps around matches. They can't appear in user
+// input that came through JSON, so they survive HTML escaping unambiguously.
+const (
+	markOpen  = "\x02"
+	markClose = "\x03"
+)
+
+// ftsAvailable reports whether the linked SQLite library includes FTS5.
+func ftsAvailable(db *sql.DB) bool {
+	var used int
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	return err == nil && used == 1
+}
+
+// Search runs a full-text query over posts and events and returns up to limit
+// results ordered by relevance, leaving out hidden content. callerUserID populates Post.UserInterested.
+// Both kinds share one index, so their bm25 scores are comparable.
+func Search(db *sql.DB, q string, limit int, callerUserID int64) ([]SearchResult, error) {
+	if !ftsAvailable(db) {
+		return nil, ErrSearchUnavailable
+	}
+
+	match := ftsQuery(q)
+	if match == "" {
+		return []SearchResult{}, nil
+	}
+
+	results := []SearchResult{}
+
+	// Posts sit at rowid 2*id and events at 2*id+1 (see migration 22).
+	rows, err := db.Query(`
+		SELECT `+postColumns+`, bm25(search_fts), snippet(search_fts, -1, ?, ?, '…', 12)
+		FROM search_fts
+		JOIN posts p ON p.id = search_fts.rowid / 2
+		`+postJoins+`
+		WHERE search_fts MATCH ? AND search_fts.kind = 'post' AND p.hidden_at IS NULL
+		ORDER BY bm25(search_fts) LIMIT ?`,
+		callerUserID, markOpen, markClose, match, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := SearchResult{Kind: "post", Post: &Post{}}
+		if err := scanPost(rows, r.Post, &r.Rank, &r.Snippet); err != nil {
+			return nil, err
+		}
+		r.Snippet = highlight(r.Snippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT `+eventColumns+`, bm25(search_fts), snippet(search_fts, -1, ?, ?, '…', 12)
+		FROM search_fts
+		JOIN events e ON e.id = search_fts.rowid / 2
+		`+eventJoins+`
+		WHERE search_fts MATCH ? AND search_fts.kind = 'event' AND e.hidden_at IS NULL
+		ORDER BY bm25(search_fts) LIMIT ?`,
+		markOpen, markClose, match, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := SearchResult{Kind: "event", Event: &Event{}}
+		if err := scanEvent(rows, r.Event, &r.Rank, &r.Snippet); err != nil {
+			return nil, err
+		}
+		r.Snippet = highlight(r.Snippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank < results[j].Rank })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// ftsQuery turns free text into an FTS5 query: every word becomes a quoted
+// prefix term, so punctuation in user input can't cause syntax errors.
+func ftsQuery(q string) string {
+	var terms []string
+	for _, word := range strings.Fields(q) {
+		word = strings.ReplaceAll(word, `"`, `""`)
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlight HTML-escapes a snippet and turns the match sentinels into <mark>.
+func highlight(snippet string) string {
+	s := html.EscapeString(snippet)
+	s = strings.ReplaceAll(s, markOpen, "<mark>")
+	return strings.ReplaceAll(s, markClose, "</mark>")
+}
@@ -95,8 +95,9 @@ func Seed(db *sql.DB) error {
 			return fmt.Errorf("hash password for %s: %w", u.Email, err)
 		}
 
+		// Demo accounts are created pre-verified so they can post right away.
 		res, err := db.Exec(
-			"INSERT INTO users (name, email, password) VALUES (?, ?, ?)",
+			"INSERT INTO users (name, email, password, verified_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)",
 			u.Name, u.Email, string(hash),
 		)
 		if err != nil {
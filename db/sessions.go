@@ -1,27 +1,53 @@
 package db
 
 import (
-	"crypto/rand"
+	"context"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// Session is a login as shown in the user's session list. The token itself
+// is never exposed.
+type Session struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // the session making the request
+}
+
+// maxUserAgentLength caps the stored User-Agent header.
+const maxUserAgentLength = 255
+
 // CreateSession generates a cryptographically random token, inserts a session
-// row that expires in 7 days, and returns the token.
-func CreateSession(db *sql.DB, userID int64) (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("generate token: %w", err)
+// row for it, and returns the token. Only the token's hash is stored. The
+// session expires once unused for ttl, and after maxAge at the latest.
+// userAgent and ip describe the device, for the user's session list.
+func CreateSession(db *sql.DB, userID int64, ttl, maxAge time.Duration, userAgent, ip string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
 	}
-	token := hex.EncodeToString(b) // 64 hex chars
 
-	expiresAt := time.Now().UTC().Add(7 * 24 * time.Hour)
+	now := time.Now().UTC()
+	maxExpiresAt := now.Add(maxAge)
+	expiresAt := now.Add(ttl)
+	if expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
 
-	_, err := db.Exec(
-		"INSERT INTO sessions (token, user_id, expires_at) VALUES (?, ?, ?)",
-		token, userID, expiresAt,
+	_, err = db.Exec(`
+		INSERT INTO sessions (token_hash, user_id, user_agent, ip, expires_at, idle_timeout, max_expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		hashToken(token), userID, userAgent, ip, expiresAt, int64(ttl.Seconds()), maxExpiresAt,
 	)
 	if err != nil {
 		return "", fmt.Errorf("insert session: %w", err)
@@ -34,8 +60,8 @@ func CreateSession(db *sql.DB, userID int64) (string, error) {
 func GetSession(db *sql.DB, token string) (int64, error) {
 	var userID int64
 	err := db.QueryRow(
-		"SELECT user_id FROM sessions WHERE token = ? AND expires_at > datetime('now')",
-		token,
+		"SELECT user_id FROM sessions WHERE token_hash = ? AND expires_at > datetime('now')",
+		hashToken(token),
 	).Scan(&userID)
 	if err != nil {
 		return 0, err
@@ -43,15 +69,84 @@ func GetSession(db *sql.DB, token string) (int64, error) {
 	return userID, nil
 }
 
+// TouchSession records that the session was just used, from ip, and pushes
+// its expiry out by its idle timeout, capped at its maximum lifetime. To save
+// a write on every request, this happens at most once a minute.
+func TouchSession(db *sql.DB, token, ip string) error {
+	_, err := db.Exec(`
+		UPDATE sessions SET
+			last_seen_at = CURRENT_TIMESTAMP,
+			ip = ?,
+			expires_at = CASE WHEN idle_timeout > 0
+				THEN MIN(datetime('now', '+' || idle_timeout || ' seconds'), datetime(max_expires_at))
+				ELSE expires_at END
+		WHERE token_hash = ? AND expires_at > datetime('now')
+			AND (last_seen_at < datetime('now', '-1 minute') OR ip != ?)`,
+		ip, hashToken(token), ip,
+	)
+	return err
+}
+
+// ListSessions returns the user's unexpired sessions, most recently used
+// first. The one with currentToken is marked Current.
+func ListSessions(db *sql.DB, userID int64, currentToken string) ([]Session, error) {
+	rows, err := db.Query(`
+		SELECT id, user_agent, ip, created_at, last_seen_at, expires_at, token_hash = ?
+		FROM sessions
+		WHERE user_id = ? AND expires_at > datetime('now')
+		ORDER BY datetime(last_seen_at) DESC, id DESC`, hashToken(currentToken), userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.Current); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession deletes one of the user's sessions and reports whether it
+// was the one with currentToken. Returns ErrNotFound if the user has no
+// session with that ID.
+func RevokeSession(db *sql.DB, userID, sessionID int64, currentToken string) (bool, error) {
+	var current bool
+	err := db.QueryRow(
+		"DELETE FROM sessions WHERE id = ? AND user_id = ? RETURNING token_hash = ?",
+		sessionID, userID, hashToken(currentToken),
+	).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return current, err
+}
+
+// DeleteUserSessions removes every session of the user, logging them out on
+// all devices. Returns the number of sessions removed.
+func DeleteUserSessions(db *sql.DB, userID int64) (int64, error) {
+	res, err := db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // DeleteSession removes the session row. Used for logout.
 func DeleteSession(db *sql.DB, token string) error {
-	_, err := db.Exec("DELETE FROM sessions WHERE token = ?", token)
+	_, err := db.Exec("DELETE FROM sessions WHERE token_hash = ?", hashToken(token))
 	return err
 }
 
 // CleanExpiredSessions deletes all sessions whose expires_at is in the past.
-func CleanExpiredSessions(db *sql.DB) (int64, error) {
-	res, err := db.Exec("DELETE FROM sessions WHERE expires_at < datetime('now')")
+// Cancelling ctx abandons the delete.
+func CleanExpiredSessions(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < datetime('now')")
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// sessionExpiry returns how far in the future the session's expires_at is.
+func sessionExpiry(tb testing.TB, database *sql.DB, token string) time.Duration {
+	tb.Helper()
+	var expiresIn float64
+	err := database.QueryRow(
+		"SELECT (julianday(expires_at) - julianday('now')) * 86400 FROM sessions WHERE token_hash = ?",
+		hashToken(token),
+	).Scan(&expiresIn)
+	if err != nil {
+		tb.Fatalf("read expires_at: %v", err)
+	}
+	return time.Duration(expiresIn * float64(time.Second))
+}
+
+func TestSessionTokenIsHashed(t *testing.T) {
+	database := openTestDB(t)
+	user := createTestUser(t, database, "jan@village.nl")
+
+	token, err := CreateSession(database, user, time.Hour, 24*time.Hour, "test", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	var stored string
+	if err := database.QueryRow("SELECT token_hash FROM sessions WHERE user_id = ?", user).Scan(&stored); err != nil {
+		t.Fatalf("read session: %v", err)
+	}
+	if stored == token {
+		t.Error("session token stored in plain text")
+	}
+	if stored != hashToken(token) {
+		t.Errorf("stored %q, want the token's hash", stored)
+	}
+
+	if got, err := GetSession(database, token); err != nil || got != user {
+		t.Errorf("GetSession(token) = %d, %v; want %d", got, err, user)
+	}
+	if _, err := GetSession(database, stored); err != sql.ErrNoRows {
+		t.Errorf("GetSession(hash) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestCreateSessionExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		maxAge time.Duration
+		want   time.Duration
+	}{
+		{"idle timeout first", time.Hour, 24 * time.Hour, time.Hour},
+		{"capped at maximum age", 48 * time.Hour, 24 * time.Hour, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openTestDB(t)
+			user := createTestUser(t, database, "jan@village.nl")
+			token, err := CreateSession(database, user, tt.ttl, tt.maxAge, "test", "10.0.0.1")
+			if err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if got := sessionExpiry(t, database, token); (got - tt.want).Abs() > time.Minute {
+				t.Errorf("expires in %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTouchSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		lastSeen   string // SQLite modifier relative to now
+		expiresIn  string
+		maxExpires string
+		ip         string
+		want       time.Duration
+	}{
+		{"slides by idle timeout", "-5 minutes", "+10 minutes", "+1 day", "10.0.0.1", time.Hour},
+		{"capped at maximum expiry", "-5 minutes", "+10 minutes", "+30 minutes", "10.0.0.1", 30 * time.Minute},
+		{"recently touched", "-10 seconds", "+10 minutes", "+1 day", "10.0.0.1", 10 * time.Minute},
+		{"recently touched from new ip", "-10 seconds", "+10 minutes", "+1 day", "10.0.0.2", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openTestDB(t)
+			user := createTestUser(t, database, "jan@village.nl")
+			token, err := CreateSession(database, user, time.Hour, 24*time.Hour, "test", "10.0.0.1")
+			if err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if _, err := database.Exec(`
+				UPDATE sessions SET last_seen_at = datetime('now', ?), expires_at = datetime('now', ?),
+					max_expires_at = datetime('now', ?)
+				WHERE token_hash = ?`, tt.lastSeen, tt.expiresIn, tt.maxExpires, hashToken(token),
+			); err != nil {
+				t.Fatalf("backdate session: %v", err)
+			}
+
+			if err := TouchSession(database, token, tt.ip); err != nil {
+				t.Fatalf("TouchSession: %v", err)
+			}
+			if got := sessionExpiry(t, database, token); (got - tt.want).Abs() > time.Minute {
+				t.Errorf("expires in %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiredSessionIsNotTouched(t *testing.T) {
+	database := openTestDB(t)
+	user := createTestUser(t, database, "jan@village.nl")
+	token, err := CreateSession(database, user, time.Hour, 24*time.Hour, "test", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := database.Exec(
+		"UPDATE sessions SET last_seen_at = datetime('now', '-2 hours'), expires_at = datetime('now', '-1 hour')",
+	); err != nil {
+		t.Fatalf("expire session: %v", err)
+	}
+
+	if err := TouchSession(database, token, "10.0.0.1"); err != nil {
+		t.Fatalf("TouchSession: %v", err)
+	}
+	if _, err := GetSession(database, token); err != sql.ErrNoRows {
+		t.Errorf("GetSession after touching an expired session: error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -1,26 +1,37 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 )
 
+// ErrEmailTaken is returned when changing to an email address that another
+// account already uses.
+var ErrEmailTaken = errors.New("email already registered")
+
 // User represents a row in the users table.
 type User struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // never serialized
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Password    string     `json:"-"` // never serialized
+	Bio         string     `json:"bio"`
+	Avatar      string     `json:"avatar"` // an emoji or a couple of characters; empty for initials
+	Role        string     `json:"role"`
+	CreatedAt   time.Time  `json:"created_at"`
+	VerifiedAt  *time.Time `json:"verified_at"`  // nil until the email address is confirmed
+	SuspendedAt *time.Time `json:"suspended_at"` // set by an admin; suspended users can't log in
 }
 
 // GetUserByID returns the user with the given ID, or an error if not found.
 func GetUserByID(db *sql.DB, id int64) (*User, error) {
 	u := &User{}
 	err := db.QueryRow(
-		"SELECT id, name, email, password, role, created_at FROM users WHERE id = ?", id,
-	).Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.Role, &u.CreatedAt)
+		"SELECT id, name, email, password, bio, avatar, role, created_at, verified_at, suspended_at FROM users WHERE id = ?", id,
+	).Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.Bio, &u.Avatar, &u.Role, &u.CreatedAt, &u.VerifiedAt, &u.SuspendedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -31,10 +42,278 @@ func GetUserByID(db *sql.DB, id int64) (*User, error) {
 func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 	u := &User{}
 	err := db.QueryRow(
-		"SELECT id, name, email, password, role, created_at FROM users WHERE email = ?", email,
-	).Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.Role, &u.CreatedAt)
+		"SELECT id, name, email, password, bio, avatar, role, created_at, verified_at, suspended_at FROM users WHERE email = ?", email,
+	).Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.Bio, &u.Avatar, &u.Role, &u.CreatedAt, &u.VerifiedAt, &u.SuspendedAt)
 	if err != nil {
 		return nil, err
 	}
 	return u, nil
 }
+
+// PublicProfile is what anyone can see about a user: no email address, and
+// counts that only include content visible to everyone.
+type PublicProfile struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	Bio             string    `json:"bio"`
+	Avatar          string    `json:"avatar"`
+	MemberSince     time.Time `json:"member_since"`
+	CompletedOffers int       `json:"completed_offers"` // offers handed over to someone
+	EventsOrganised int       `json:"events_organised"`
+}
+
+// GetPublicProfile returns the user's public profile. Returns ErrNotFound for
+// suspended accounts and accounts pending deletion too.
+func GetPublicProfile(db *sql.DB, id int64) (*PublicProfile, error) {
+	p := &PublicProfile{}
+	err := db.QueryRow(`
+		SELECT u.id, u.name, u.bio, u.avatar, u.created_at,
+		       (SELECT COUNT(*) FROM posts p
+		        WHERE p.user_id = u.id AND p.type = 'offer' AND p.status = 'completed' AND p.hidden_at IS NULL),
+		       (SELECT COUNT(*) FROM events e WHERE e.user_id = u.id AND e.hidden_at IS NULL)
+		FROM users u
+		WHERE u.id = ? AND u.suspended_at IS NULL AND u.delete_after IS NULL`, id,
+	).Scan(&p.ID, &p.Name, &p.Bio, &p.Avatar, &p.MemberSince, &p.CompletedOffers, &p.EventsOrganised)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// IsUserVerified reports whether the user has confirmed their email address.
+func IsUserVerified(db *sql.DB, id int64) (bool, error) {
+	var verified bool
+	err := db.QueryRow("SELECT verified_at IS NOT NULL FROM users WHERE id = ?", id).Scan(&verified)
+	return verified, err
+}
+
+// GetUserRole returns the user's role, e.g. RoleVillager or RoleAdmin.
+func GetUserRole(db *sql.DB, id int64) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = ?", id).Scan(&role)
+	return role, err
+}
+
+// SetUserRoleByEmail sets a user's role directly, outside the moderation log.
+// Used by the -admin command-line flag to create the first admin.
+// Returns ErrNotFound if no user has that email.
+func SetUserRoleByEmail(db *sql.DB, email, role string) error {
+	if role != RoleVillager && role != RoleAdmin {
+		return ErrInvalidRole
+	}
+	res, err := db.Exec("UPDATE users SET role = ? WHERE email = ?", role, email)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// LoginLockedUntil returns the end of the user's login lock for ip, or nil if
+// logins from there aren't locked.
+func LoginLockedUntil(db *sql.DB, userID int64, ip string) (*time.Time, error) {
+	var until time.Time
+	err := db.QueryRow(
+		"SELECT locked_until FROM login_failures WHERE user_id = ? AND ip = ? AND locked_until > ?",
+		userID, ip, time.Now().UTC(),
+	).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &until, nil
+}
+
+// RecordFailedLogin counts a wrong password for the user from ip. On the
+// threshold-th failure in a row the account is locked for that IP for
+// lockFor and the count starts over; the returned time is the end of that
+// lock, or nil if not locked.
+//
+// Counting per account alone would let anyone who knows an address keep its
+// owner locked out by guessing wrong. The price is that each IP gets its own
+// allowance, so the per-email rate limit is what bounds guessing spread over
+// many addresses.
+func RecordFailedLogin(db *sql.DB, userID int64, ip string, threshold int, lockFor time.Duration) (*time.Time, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	if err := tx.QueryRow(`
+		INSERT INTO login_failures (user_id, ip, failures) VALUES (?, ?, 1)
+		ON CONFLICT (user_id, ip) DO UPDATE SET failures = failures + 1, last_failed_at = CURRENT_TIMESTAMP
+		RETURNING failures`, userID, ip,
+	).Scan(&failures); err != nil {
+		return nil, err
+	}
+
+	var lockedUntil *time.Time
+	if threshold > 0 && failures >= threshold {
+		until := time.Now().UTC().Add(lockFor)
+		if _, err := tx.Exec(
+			"UPDATE login_failures SET failures = 0, locked_until = ? WHERE user_id = ? AND ip = ?", until, userID, ip,
+		); err != nil {
+			return nil, err
+		}
+		lockedUntil = &until
+	}
+	return lockedUntil, tx.Commit()
+}
+
+// ResetFailedLogins clears the failure count and any lock for ip after a
+// successful login from there.
+func ResetFailedLogins(db *sql.DB, userID int64, ip string) error {
+	_, err := db.Exec("DELETE FROM login_failures WHERE user_id = ? AND ip = ?", userID, ip)
+	return err
+}
+
+// CleanLoginFailures deletes failure counts whose lock has ended, or that
+// haven't grown for a day. Cancelling ctx abandons the delete.
+func CleanLoginFailures(ctx context.Context, db *sql.DB) (int64, error) {
+	now := time.Now().UTC()
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM login_failures
+		WHERE (locked_until IS NOT NULL AND locked_until <= ?)
+			OR (locked_until IS NULL AND last_failed_at < datetime('now', '-1 day'))`, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UpdateUserProfile sets the user's name, email address, bio and avatar.
+// Changing the address marks the account unverified again and uses up any
+// outstanding verification and password reset tokens, which were sent to
+// the old address.
+// Reports whether the address changed; returns ErrEmailTaken if another
+// account has it and ErrNotFound if the user doesn't exist.
+func UpdateUserProfile(db *sql.DB, userID int64, name, email, bio, avatar string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var oldEmail string
+	err = tx.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&oldEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	changed := email != oldEmail
+
+	_, err = tx.Exec(`
+		UPDATE users SET name = ?, email = ?, bio = ?, avatar = ?,
+			verified_at = CASE WHEN ? THEN NULL ELSE verified_at END
+		WHERE id = ?`,
+		name, email, bio, avatar, changed, userID,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint") {
+			return false, ErrEmailTaken
+		}
+		return false, err
+	}
+	if changed {
+		if _, err := tx.Exec(
+			"UPDATE email_verifications SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND used_at IS NULL", userID,
+		); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(
+			"UPDATE password_resets SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND used_at IS NULL", userID,
+		); err != nil {
+			return false, err
+		}
+	}
+	return changed, tx.Commit()
+}
+
+// SetUserPassword sets the user's password hash, uses up any outstanding
+// password reset tokens and deletes all of their sessions except the one
+// with keepToken, so a changed password logs out every other device.
+func SetUserPassword(db *sql.DB, userID int64, passwordHash, keepToken string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", passwordHash, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE password_resets SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND used_at IS NULL", userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"DELETE FROM sessions WHERE user_id = ? AND token_hash != ?", userID, hashToken(keepToken),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteUser removes the account. Its sessions, tokens, posts, events,
+// interests, reports and messages go with it through ON DELETE CASCADE.
+func DeleteUser(db *sql.DB, userID int64) error {
+	_, err := db.Exec("DELETE FROM users WHERE id = ?", userID)
+	return err
+}
+
+// ScheduleUserDeletion marks the account for deletion at the given time and
+// logs it out everywhere. Logging in again before then cancels it (see
+// CancelUserDeletion); DeleteScheduledUsers carries it out.
+func ScheduleUserDeletion(db *sql.DB, userID int64, at time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET delete_after = ? WHERE id = ?", at.UTC(), userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CancelUserDeletion clears a scheduled deletion and reports whether there
+// was one.
+func CancelUserDeletion(db *sql.DB, userID int64) (bool, error) {
+	res, err := db.Exec("UPDATE users SET delete_after = NULL WHERE id = ? AND delete_after IS NOT NULL", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteScheduledUsers deletes accounts whose grace period has ended and
+// returns how many were removed. Cancelling ctx abandons the delete.
+func DeleteScheduledUsers(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM users WHERE delete_after <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
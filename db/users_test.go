@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	const threshold = 3
+	database := openTestDB(t)
+	user := createTestUser(t, database, "jan@village.nl")
+
+	// Each step is one wrong password; wantLocked is whether the account is
+	// then locked for that IP.
+	steps := []struct {
+		ip         string
+		wantLocked bool
+	}{
+		{"10.0.0.1", false},
+		{"10.0.0.1", false},
+		{"10.0.0.2", false}, // another IP has its own count
+		{"10.0.0.1", true},
+		{"10.0.0.2", false},
+	}
+	for i, s := range steps {
+		until, err := RecordFailedLogin(database, user, s.ip, threshold, time.Hour)
+		if err != nil {
+			t.Fatalf("step %d: RecordFailedLogin: %v", i, err)
+		}
+		if (until != nil) != s.wantLocked {
+			t.Errorf("step %d (%s): locked until %v, want locked %v", i, s.ip, until, s.wantLocked)
+		}
+	}
+
+	for _, tt := range []struct {
+		ip         string
+		wantLocked bool
+	}{
+		{"10.0.0.1", true},
+		{"10.0.0.2", false}, // the owner's own IP is unaffected
+		{"10.0.0.3", false},
+	} {
+		until, err := LoginLockedUntil(database, user, tt.ip)
+		if err != nil {
+			t.Fatalf("LoginLockedUntil(%s): %v", tt.ip, err)
+		}
+		if (until != nil) != tt.wantLocked {
+			t.Errorf("LoginLockedUntil(%s) = %v, want locked %v", tt.ip, until, tt.wantLocked)
+		}
+	}
+
+	if err := ResetFailedLogins(database, user, "10.0.0.1"); err != nil {
+		t.Fatalf("ResetFailedLogins: %v", err)
+	}
+	if until, err := LoginLockedUntil(database, user, "10.0.0.1"); err != nil || until != nil {
+		t.Errorf("after reset: LoginLockedUntil = %v, %v; want nil, nil", until, err)
+	}
+}
+
+func TestLoginLockoutDisabled(t *testing.T) {
+	database := openTestDB(t)
+	user := createTestUser(t, database, "jan@village.nl")
+
+	for i := 0; i < 10; i++ {
+		until, err := RecordFailedLogin(database, user, "10.0.0.1", 0, time.Hour)
+		if err != nil {
+			t.Fatalf("RecordFailedLogin: %v", err)
+		}
+		if until != nil {
+			t.Fatalf("failure %d locked the account with a zero threshold", i+1)
+		}
+	}
+}
+
+func TestCleanLoginFailures(t *testing.T) {
+	database := openTestDB(t)
+	user := createTestUser(t, database, "jan@village.nl")
+
+	// An expired lock is cleaned up; a running one is kept.
+	if _, err := RecordFailedLogin(database, user, "10.0.0.1", 1, -time.Minute); err != nil {
+		t.Fatalf("RecordFailedLogin: %v", err)
+	}
+	if _, err := RecordFailedLogin(database, user, "10.0.0.2", 1, time.Hour); err != nil {
+		t.Fatalf("RecordFailedLogin: %v", err)
+	}
+
+	n, err := CleanLoginFailures(context.Background(), database)
+	if err != nil {
+		t.Fatalf("CleanLoginFailures: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("cleaned %d rows, want 1", n)
+	}
+	if until, _ := LoginLockedUntil(database, user, "10.0.0.2"); until == nil {
+		t.Error("running lock was cleaned up")
+	}
+}
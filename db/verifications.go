@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CreateEmailVerification issues a single-use token that confirms the user's
+// current email address, valid for ttl. Only its hash is stored.
+func CreateEmailVerification(db *sql.DB, userID int64, ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO email_verifications (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, hashToken(token), time.Now().UTC().Add(ttl),
+	)
+	if err != nil {
+		return "", fmt.Errorf("insert email verification: %w", err)
+	}
+	return token, nil
+}
+
+// VerifyEmail redeems a verification token, marks the user as verified and
+// uses up any other outstanding tokens for them. Returns ErrInvalidToken if
+// the token is unknown, expired or already used.
+func VerifyEmail(db *sql.DB, token string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`
+		SELECT user_id FROM email_verifications
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?`,
+		hashToken(token), time.Now().UTC(),
+	).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE users SET verified_at = CURRENT_TIMESTAMP WHERE id = ? AND verified_at IS NULL", userID,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(
+		"UPDATE email_verifications SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND used_at IS NULL", userID,
+	); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// CleanExpiredEmailVerifications deletes verification tokens that can no
+// longer be used. Cancelling ctx abandons the delete.
+func CleanExpiredEmailVerifications(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM email_verifications WHERE expires_at < ? OR used_at IS NOT NULL", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
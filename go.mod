@@ -3,6 +3,7 @@ module village-square
 go 1.25.3
 
 require (
-	github.com/mattn/go-sqlite3 v1.14.34 // indirect
-	golang.org/x/crypto v0.48.0 // indirect
+	github.com/andybalholm/brotli v1.2.5
+	github.com/mattn/go-sqlite3 v1.14.34
+	golang.org/x/crypto v0.48.0
 )
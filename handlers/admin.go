@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"village-square/db"
+	"village-square/middleware"
+	"village-square/scheduler"
+)
+
+// maxReasonLength caps the free-text reason stored with moderation actions.
+const maxReasonLength = 500
+
+// decodeReason reads the optional {"reason": "..."} body sent with moderation
+// actions. An empty body is allowed. Returns an error message or "".
+func decodeReason(r *http.Request) (string, string) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return "", "invalid JSON"
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > maxReasonLength {
+		return "", "reason must be 500 characters or fewer"
+	}
+	return reason, ""
+}
+
+// canSeeHidden reports whether the caller may view content hidden by a
+// moderator: only its author and admins can.
+func canSeeHidden(database *sql.DB, callerID, authorID int64) bool {
+	if callerID == 0 {
+		return false
+	}
+	if callerID == authorID {
+		return true
+	}
+	role, err := db.GetUserRole(database, callerID)
+	return err == nil && role == db.RoleAdmin
+}
+
+// AdminDeletePost handles DELETE /api/admin/posts/{id} (admin only).
+func AdminDeletePost(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+		reason, msg := decodeReason(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		adminID, _ := middleware.GetUserID(r)
+		err = db.ModerateDeletePost(database, adminID, id, reason)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not delete post")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"message": "post deleted"})
+	}
+}
+
+// AdminDeleteEvent handles DELETE /api/admin/events/{id} (admin only).
+func AdminDeleteEvent(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid event id")
+			return
+		}
+		reason, msg := decodeReason(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		adminID, _ := middleware.GetUserID(r)
+		err = db.ModerateDeleteEvent(database, adminID, id, reason)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not delete event")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"message": "event deleted"})
+	}
+}
+
+// AdminHidePost handles POST /api/admin/posts/{id}/hide and /unhide (admin only).
+func AdminHidePost(database *sql.DB, hidden bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+		reason, msg := decodeReason(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		adminID, _ := middleware.GetUserID(r)
+		err = db.ModerateHidePost(database, adminID, id, hidden, reason)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update post")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hidden": hidden})
+	}
+}
+
+// AdminHideEvent handles POST /api/admin/events/{id}/hide and /unhide (admin only).
+func AdminHideEvent(database *sql.DB, hidden bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid event id")
+			return
+		}
+		reason, msg := decodeReason(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		adminID, _ := middleware.GetUserID(r)
+		err = db.ModerateHideEvent(database, adminID, id, hidden, reason)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update event")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "hidden": hidden})
+	}
+}
+
+// AdminSuspendUser handles POST /api/admin/users/{id}/suspend and /unsuspend
+// (admin only). Suspending a user also logs them out everywhere.
+func AdminSuspendUser(database *sql.DB, suspended bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+		reason, msg := decodeReason(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		adminID, _ := middleware.GetUserID(r)
+		if id == adminID {
+			writeError(w, http.StatusBadRequest, "cannot suspend yourself")
+			return
+		}
+
+		err = db.ModerateSuspendUser(database, adminID, id, suspended, reason)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update user")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "suspended": suspended})
+	}
+}
+
+// AdminSetRole handles POST /api/admin/users/{id}/role (admin only).
+// Body: {"role": "admin"|"villager", "reason": "..."}.
+func AdminSetRole(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+
+		var req struct {
+			Role   string `json:"role"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if len(req.Reason) > maxReasonLength {
+			writeError(w, http.StatusBadRequest, "reason must be 500 characters or fewer")
+			return
+		}
+
+		adminID, _ := middleware.GetUserID(r)
+		if id == adminID {
+			writeError(w, http.StatusBadRequest, "cannot change your own role")
+			return
+		}
+
+		err = db.ModerateSetRole(database, adminID, id, req.Role, req.Reason)
+		if err == db.ErrInvalidRole {
+			writeError(w, http.StatusBadRequest, "role must be one of: villager, admin")
+			return
+		}
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update user")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "role": req.Role})
+	}
+}
+
+// ModerationLog handles GET /api/admin/log (admin only).
+func ModerationLog(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, msg := parseLimit(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		entries, err := db.ListModerationLog(database, limit)
+		if err != nil {
+			serverError(w, r, err, "could not list moderation log")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"entries": entries, "count": len(entries)})
+	}
+}
+
+// JobStatus handles GET /api/admin/jobs (admin only): the last run and
+// outcome of each background job.
+func JobStatus(sched *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobs := sched.Status()
+		writeJSON(w, http.StatusOK, map[string]any{"jobs": jobs, "count": len(jobs)})
+	}
+}
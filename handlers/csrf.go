@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"village-square/middleware"
+)
+
+// CSRFToken handles GET /api/csrf (auth required). It returns the token to
+// send in the X-CSRF-Token header on requests that change state.
+func CSRFToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, map[string]string{
+			"token":  middleware.CSRFToken(cookie.Value),
+			"header": middleware.CSRFHeader,
+		})
+	}
+}
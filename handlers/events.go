@@ -20,116 +20,273 @@ var validEventTypes = map[string]bool{
 	"other":       true,
 }
 
+// eventFields holds the user-editable event fields, as sent by the client.
+type eventFields struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	EventType   string `json:"event_type"`
+	Location    string `json:"location"`
+	StartTime   string `json:"start_time"`
+	EndTime     string `json:"end_time"`
+}
+
+// validateEventFields trims and checks f in place and parses its RFC3339
+// times. It returns a user-facing error message, or "" if the fields are valid.
+func validateEventFields(f *eventFields) (startTime time.Time, endTime *time.Time, msg string) {
+	// Validate title.
+	f.Title = strings.TrimSpace(f.Title)
+	if f.Title == "" {
+		return startTime, nil, "title is required"
+	}
+	if len(f.Title) > 200 {
+		return startTime, nil, "title must be under 200 characters"
+	}
+
+	// Validate description.
+	f.Description = strings.TrimSpace(f.Description)
+	if len(f.Description) > 2000 {
+		return startTime, nil, "description must be under 2000 characters"
+	}
+
+	// Validate event_type.
+	if !validEventTypes[f.EventType] {
+		return startTime, nil, "event_type must be garage_sale, sport, gathering, or other"
+	}
+
+	// Validate location.
+	f.Location = strings.TrimSpace(f.Location)
+	if len(f.Location) > 200 {
+		return startTime, nil, "location must be under 200 characters"
+	}
+
+	// Validate start_time.
+	if f.StartTime == "" {
+		return startTime, nil, "start_time is required"
+	}
+	startTime, err := time.Parse(time.RFC3339, f.StartTime)
+	if err != nil {
+		return startTime, nil, "start_time must be a valid RFC3339 datetime"
+	}
+
+	// Validate end_time (optional).
+	if f.EndTime != "" {
+		t, err := time.Parse(time.RFC3339, f.EndTime)
+		if err != nil {
+			return startTime, nil, "end_time must be a valid RFC3339 datetime"
+		}
+		if !t.After(startTime) {
+			return startTime, nil, "end_time must be after start_time"
+		}
+		endTime = &t
+	}
+
+	return startTime, endTime, ""
+}
+
 // CreateEvent handles POST /api/events (auth required).
 func CreateEvent(database *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			EventType   string `json:"event_type"`
-			Location    string `json:"location"`
-			StartTime   string `json:"start_time"`
-			EndTime     string `json:"end_time"`
-		}
+		var req eventFields
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeError(w, http.StatusBadRequest, "invalid JSON")
 			return
 		}
 
-		// Validate title.
-		req.Title = strings.TrimSpace(req.Title)
-		if req.Title == "" {
-			writeError(w, http.StatusBadRequest, "title is required")
+		startTime, endTime, msg := validateEventFields(&req)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
 			return
 		}
-		if len(req.Title) > 200 {
-			writeError(w, http.StatusBadRequest, "title must be under 200 characters")
+
+		userID, _ := middleware.GetUserID(r)
+
+		event, err := db.CreateEvent(database, userID, req.Title, req.Description, req.EventType, req.Location, startTime, endTime)
+		if err != nil {
+			serverError(w, r, err, "could not create event")
 			return
 		}
 
-		// Validate description.
-		req.Description = strings.TrimSpace(req.Description)
-		if len(req.Description) > 2000 {
-			writeError(w, http.StatusBadRequest, "description must be under 2000 characters")
+		writeJSON(w, http.StatusCreated, event)
+	}
+}
+
+// ListEvents handles GET /api/events (public).
+func ListEvents(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventType := r.URL.Query().Get("type")
+
+		if eventType != "" && !validEventTypes[eventType] {
+			writeError(w, http.StatusBadRequest, "invalid event type filter")
 			return
 		}
 
-		// Validate event_type.
-		if !validEventTypes[req.EventType] {
-			writeError(w, http.StatusBadRequest, "event_type must be garage_sale, sport, gathering, or other")
+		filter := db.EventFilter{Type: eventType}
+		if v := r.URL.Query().Get("upcoming"); v != "" {
+			upcoming, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "upcoming must be true or false")
+				return
+			}
+			filter.Upcoming = upcoming
+		}
+
+		limit, after, msg := parsePage(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
 			return
 		}
 
-		// Validate location.
-		req.Location = strings.TrimSpace(req.Location)
-		if len(req.Location) > 200 {
-			writeError(w, http.StatusBadRequest, "location must be under 200 characters")
+		events, next, err := db.ListEvents(database, filter, limit, after)
+		if err != nil {
+			serverError(w, r, err, "could not list events")
 			return
 		}
 
-		// Validate start_time.
-		if req.StartTime == "" {
-			writeError(w, http.StatusBadRequest, "start_time is required")
+		total, err := db.CountEvents(database, filter)
+		if err != nil {
+			serverError(w, r, err, "could not count events")
 			return
 		}
-		startTime, err := time.Parse(time.RFC3339, req.StartTime)
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"events":      events,
+			"count":       len(events),
+			"total":       total,
+			"next_cursor": cursorString(next),
+		})
+	}
+}
+
+// GetEvent handles GET /api/events/{id} (public).
+func GetEvent(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.PathValue("id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, "start_time must be a valid RFC3339 datetime")
+			writeError(w, http.StatusBadRequest, "invalid event id")
 			return
 		}
 
-		// Validate end_time (optional).
-		var endTime *time.Time
-		if req.EndTime != "" {
-			t, err := time.Parse(time.RFC3339, req.EndTime)
-			if err != nil {
-				writeError(w, http.StatusBadRequest, "end_time must be a valid RFC3339 datetime")
-				return
+		event, err := db.GetEventByID(database, id)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve event")
+			return
+		}
+
+		if event.Hidden {
+			var callerUserID int64
+			if cookie, err := r.Cookie("session"); err == nil {
+				if uid, err := db.GetSession(database, cookie.Value); err == nil {
+					callerUserID = uid
+				}
 			}
-			if !t.After(startTime) {
-				writeError(w, http.StatusBadRequest, "end_time must be after start_time")
+			if !canSeeHidden(database, callerUserID, event.UserID) {
+				writeError(w, http.StatusNotFound, "event not found")
 				return
 			}
-			endTime = &t
 		}
 
-		userID, _ := middleware.GetUserID(r)
+		writeJSON(w, http.StatusOK, event)
+	}
+}
 
-		event, err := db.CreateEvent(database, userID, req.Title, req.Description, req.EventType, req.Location, startTime, endTime)
+// UpdateEvent handles PATCH /api/events/{id} (auth required).
+// Omitted fields keep their current value; "end_time": "" clears the end time.
+func UpdateEvent(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not create event")
+			writeError(w, http.StatusBadRequest, "invalid event id")
 			return
 		}
 
-		writeJSON(w, http.StatusCreated, event)
-	}
-}
+		var req struct {
+			Title       *string `json:"title"`
+			Description *string `json:"description"`
+			EventType   *string `json:"event_type"`
+			Location    *string `json:"location"`
+			StartTime   *string `json:"start_time"`
+			EndTime     *string `json:"end_time"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
 
-// ListEvents handles GET /api/events (public).
-func ListEvents(database *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		eventType := r.URL.Query().Get("type")
+		event, err := db.GetEventByID(database, id)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve event")
+			return
+		}
 
-		if eventType != "" && !validEventTypes[eventType] {
-			writeError(w, http.StatusBadRequest, "invalid event type filter")
+		userID, _ := middleware.GetUserID(r)
+		if event.UserID != userID {
+			writeError(w, http.StatusForbidden, "you can only edit your own events")
+			return
+		}
+
+		// Start from the current values and apply the fields that were sent.
+		f := eventFields{
+			Title:       event.Title,
+			Description: event.Description,
+			EventType:   event.EventType,
+			Location:    event.Location,
+			StartTime:   event.StartTime.Format(time.RFC3339Nano), // keep sub-second times, or they'd log as changed
+		}
+		if event.EndTime != nil {
+			f.EndTime = event.EndTime.Format(time.RFC3339Nano)
+		}
+		if req.Title != nil {
+			f.Title = *req.Title
+		}
+		if req.Description != nil {
+			f.Description = *req.Description
+		}
+		if req.EventType != nil {
+			f.EventType = *req.EventType
+		}
+		if req.Location != nil {
+			f.Location = *req.Location
+		}
+		if req.StartTime != nil {
+			f.StartTime = *req.StartTime
+		}
+		if req.EndTime != nil {
+			f.EndTime = *req.EndTime
+		}
+
+		startTime, endTime, msg := validateEventFields(&f)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
 			return
 		}
 
-		events, err := db.ListEvents(database, eventType)
+		updated, err := db.UpdateEvent(database, id, userID, f.Title, f.Description, f.EventType, f.Location, startTime, endTime)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not list events")
+			serverError(w, r, err, "could not update event")
 			return
 		}
 
-		writeJSON(w, http.StatusOK, map[string]any{"events": events, "count": len(events)})
+		writeJSON(w, http.StatusOK, updated)
 	}
 }
 
-// GetEvent handles GET /api/events/{id} (public).
-func GetEvent(database *sql.DB) http.HandlerFunc {
+// ListEventChanges handles GET /api/events/{id}/changes (public).
+func ListEventChanges(database *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := r.PathValue("id")
-		id, err := strconv.ParseInt(idStr, 10, 64)
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, "invalid event id")
 			return
@@ -141,11 +298,32 @@ func GetEvent(database *sql.DB) http.HandlerFunc {
 			return
 		}
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not retrieve event")
+			serverError(w, r, err, "could not retrieve event")
 			return
 		}
 
-		writeJSON(w, http.StatusOK, event)
+		// Like GetEvent, a hidden event's history is only shown to its
+		// author and to admins.
+		if event.Hidden {
+			var callerUserID int64
+			if cookie, err := r.Cookie("session"); err == nil {
+				if uid, err := db.GetSession(database, cookie.Value); err == nil {
+					callerUserID = uid
+				}
+			}
+			if !canSeeHidden(database, callerUserID, event.UserID) {
+				writeError(w, http.StatusNotFound, "event not found")
+				return
+			}
+		}
+
+		changes, err := db.ListEventChanges(database, id)
+		if err != nil {
+			serverError(w, r, err, "could not list event changes")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"changes": changes, "count": len(changes)})
 	}
 }
 
@@ -167,7 +345,7 @@ func DeleteEvent(database *sql.DB) http.HandlerFunc {
 			return
 		}
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not delete event")
+			serverError(w, r, err, "could not delete event")
 			return
 		}
 
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	vsdb "village-square/db"
+	"village-square/middleware"
+)
+
+// userExport is everything held about a user, for ExportMe. Profile is a
+// *vsdb.User, whose password hash is never serialized.
+type userExport struct {
+	Profile   *vsdb.User
+	Posts     []vsdb.Post
+	Events    []vsdb.Event
+	Interests []vsdb.UserInterest
+	Sessions  []vsdb.Session
+}
+
+// ExportMe handles GET /api/me/export (auth required): a ZIP with the user's
+// profile, posts, events, interests and sessions, each as JSON and CSV.
+func ExportMe(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+		cookie, _ := r.Cookie("session")
+
+		// Gather everything first, so a failure can still be reported as an
+		// error instead of a broken download.
+		var data userExport
+		var err error
+		if data.Profile, err = vsdb.GetUserByID(db, userID); err != nil {
+			serverError(w, r, err, "could not export profile")
+			return
+		}
+		if data.Posts, err = vsdb.ListUserPosts(db, userID); err != nil {
+			serverError(w, r, err, "could not export posts")
+			return
+		}
+		if data.Events, err = vsdb.ListUserEvents(db, userID); err != nil {
+			serverError(w, r, err, "could not export events")
+			return
+		}
+		if data.Interests, err = vsdb.ListUserInterests(db, userID); err != nil {
+			serverError(w, r, err, "could not export interests")
+			return
+		}
+		if data.Sessions, err = vsdb.ListSessions(db, userID, cookie.Value); err != nil {
+			serverError(w, r, err, "could not export sessions")
+			return
+		}
+
+		filename := fmt.Sprintf("village-square-export-%d-%s.zip", userID, time.Now().UTC().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Header().Set("Cache-Control", "no-store")
+
+		// Past this point the status is sent; a failure just cuts the
+		// download short.
+		if err := writeExport(w, &data); err != nil {
+			middleware.Logger(r.Context()).Error("could not write export", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// writeExport writes data to w as a ZIP archive.
+func writeExport(w io.Writer, data *userExport) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+
+	files := []struct {
+		name string
+		json any
+		csv  [][]string
+	}{
+		{"profile", data.Profile, profileCSV(data.Profile)},
+		{"posts", data.Posts, postsCSV(data.Posts)},
+		{"events", data.Events, eventsCSV(data.Events)},
+		{"interests", data.Interests, interestsCSV(data.Interests)},
+		{"sessions", data.Sessions, sessionsCSV(data.Sessions)},
+	}
+	for _, f := range files {
+		jw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name + ".json", Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(jw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.json); err != nil {
+			return err
+		}
+
+		cw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name + ".csv", Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if err := csv.NewWriter(cw).WriteAll(f.csv); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func profileCSV(u *vsdb.User) [][]string {
+	return [][]string{
+		{"id", "name", "email", "bio", "avatar", "role", "created_at", "verified_at", "suspended_at"},
+		{itoa(u.ID), u.Name, u.Email, u.Bio, u.Avatar, u.Role, csvTime(&u.CreatedAt), csvTime(u.VerifiedAt), csvTime(u.SuspendedAt)},
+	}
+}
+
+func postsCSV(posts []vsdb.Post) [][]string {
+	rows := [][]string{{"id", "type", "title", "body", "category", "status", "event_id", "interest_count", "hidden", "created_at"}}
+	for _, p := range posts {
+		eventID := ""
+		if p.EventID != nil {
+			eventID = itoa(*p.EventID)
+		}
+		rows = append(rows, []string{
+			itoa(p.ID), p.Type, p.Title, p.Body, p.Category, p.Status, eventID,
+			strconv.Itoa(p.InterestCount), strconv.FormatBool(p.Hidden), csvTime(&p.CreatedAt),
+		})
+	}
+	return rows
+}
+
+func eventsCSV(events []vsdb.Event) [][]string {
+	rows := [][]string{{"id", "title", "description", "event_type", "location", "start_time", "end_time", "hidden", "created_at"}}
+	for _, e := range events {
+		rows = append(rows, []string{
+			itoa(e.ID), e.Title, e.Description, e.EventType, e.Location, csvTime(&e.StartTime), csvTime(e.EndTime),
+			strconv.FormatBool(e.Hidden), csvTime(&e.CreatedAt),
+		})
+	}
+	return rows
+}
+
+func interestsCSV(interests []vsdb.UserInterest) [][]string {
+	rows := [][]string{{"post_id", "post_title", "chosen", "created_at"}}
+	for _, in := range interests {
+		rows = append(rows, []string{itoa(in.PostID), in.PostTitle, strconv.FormatBool(in.Chosen), csvTime(&in.CreatedAt)})
+	}
+	return rows
+}
+
+func sessionsCSV(sessions []vsdb.Session) [][]string {
+	rows := [][]string{{"id", "user_agent", "ip", "created_at", "last_seen_at", "expires_at", "current"}}
+	for _, s := range sessions {
+		rows = append(rows, []string{
+			itoa(s.ID), s.UserAgent, s.IP, csvTime(&s.CreatedAt), csvTime(&s.LastSeenAt), csvTime(&s.ExpiresAt),
+			strconv.FormatBool(s.Current),
+		})
+	}
+	return rows
+}
+
+func itoa(n int64) string { return strconv.FormatInt(n, 10) }
+
+// csvTime formats t as RFC 3339 in UTC, or "" for nil.
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+
+	"village-square/middleware"
 )
 
 // Health returns a handler that pings the database and reports its status.
@@ -12,6 +14,7 @@ func Health(db *sql.DB) http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 
 		if err := db.Ping(); err != nil {
+			middleware.Logger(r.Context()).Error("health check failed", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{
 				"status":  "error",
@@ -21,12 +21,12 @@ func ToggleInterest(database *sql.DB) http.HandlerFunc {
 		callerID, _ := middleware.GetUserID(r)
 
 		post, err := db.GetPostByID(database, id, callerID)
-		if err == sql.ErrNoRows {
+		if err == sql.ErrNoRows || (err == nil && post.Hidden) {
 			writeError(w, http.StatusNotFound, "post not found")
 			return
 		}
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not retrieve post")
+			serverError(w, r, err, "could not retrieve post")
 			return
 		}
 
@@ -42,20 +42,25 @@ func ToggleInterest(database *sql.DB) http.HandlerFunc {
 
 		already, err := db.HasUserInterest(database, id, callerID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not check interest")
+			serverError(w, r, err, "could not check interest")
+			return
+		}
+
+		if !already && post.Status != db.StatusAvailable && post.Status != db.StatusReserved {
+			writeError(w, http.StatusBadRequest, "this post is no longer available")
 			return
 		}
 
 		var interested bool
 		if already {
 			if err := db.DeleteInterest(database, id, callerID); err != nil {
-				writeError(w, http.StatusInternalServerError, "could not remove interest")
+				serverError(w, r, err, "could not remove interest")
 				return
 			}
 			interested = false
 		} else {
 			if err := db.CreateInterest(database, id, callerID); err != nil {
-				writeError(w, http.StatusInternalServerError, "could not add interest")
+				serverError(w, r, err, "could not add interest")
 				return
 			}
 			interested = true
@@ -63,7 +68,7 @@ func ToggleInterest(database *sql.DB) http.HandlerFunc {
 
 		count, err := db.GetInterestCount(database, id)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not get interest count")
+			serverError(w, r, err, "could not get interest count")
 			return
 		}
 
@@ -73,3 +78,99 @@ func ToggleInterest(database *sql.DB) http.HandlerFunc {
 		})
 	}
 }
+
+// ListPostInterests handles GET /api/posts/{id}/interests (auth required).
+// Only the post's author can see who is interested.
+func ListPostInterests(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+
+		callerID, _ := middleware.GetUserID(r)
+
+		post, err := db.GetPostByID(database, id, callerID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.UserID != callerID {
+			writeError(w, http.StatusForbidden, "only the author can see who is interested")
+			return
+		}
+
+		interests, err := db.ListInterests(database, id)
+		if err != nil {
+			serverError(w, r, err, "could not list interests")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"interests": interests, "count": len(interests)})
+	}
+}
+
+// ChooseInterest handles POST and DELETE /api/posts/{id}/interests/{user_id}/choose
+// (auth required). The author picks one interested villager, which reserves
+// the post for them; DELETE undoes the choice.
+func ChooseInterest(database *sql.DB, chosen bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+		userID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+
+		callerID, _ := middleware.GetUserID(r)
+
+		post, err := db.GetPostByID(database, id, callerID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.UserID != callerID {
+			writeError(w, http.StatusForbidden, "only the author can choose an interested villager")
+			return
+		}
+
+		if chosen {
+			err = db.ChooseInterest(database, id, userID)
+		} else {
+			err = db.UnchooseInterest(database, id, userID)
+		}
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "interest not found")
+			return
+		}
+		if err == db.ErrInvalidTransition {
+			writeError(w, http.StatusConflict, "cannot reserve a "+post.Status+" post")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update interest")
+			return
+		}
+
+		updated, err := db.GetPostByID(database, id, callerID)
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"user_id": userID, "chosen": chosen, "status": updated.Status})
+	}
+}
@@ -3,10 +3,14 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	vsdb "village-square/db"
+	"village-square/middleware"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -17,8 +21,25 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+// LoginOptions configures the Login handler.
+type LoginOptions struct {
+	SessionTTL    time.Duration // idle time after which a session expires
+	SessionMaxAge time.Duration // lifetime of a session however active; also the cookie's
+	SecureCookies bool          // mark the cookie HTTPS-only
+
+	// EmailLimiter rate-limits attempts per account, on top of any per-IP
+	// limit on the route, so one account can't be attacked from many IPs.
+	EmailLimiter *middleware.Limiter
+
+	// After LockoutThreshold wrong passwords in a row from one IP the account
+	// is locked for that IP for LockoutDuration. A threshold of 0 disables
+	// lockout.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
 // Login returns a handler that authenticates a user and sets a session cookie.
-func Login(db *sql.DB) http.HandlerFunc {
+func Login(db *sql.DB, opts LoginOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -39,39 +60,100 @@ func Login(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Limit attempts per account before doing any bcrypt work.
+		if ok, wait := opts.EmailLimiter.Allow("email:" + strings.ToLower(req.Email)); !ok {
+			middleware.WriteRateLimited(w, wait)
+			return
+		}
+
 		// Look up user by email.
 		user, err := vsdb.GetUserByEmail(db, req.Email)
-		if err != nil {
+		if err == sql.ErrNoRows {
 			// Same message whether user not found or wrong password.
 			writeError(w, http.StatusUnauthorized, "invalid credentials")
 			return
 		}
+		if err != nil {
+			serverError(w, r, err, "could not log in")
+			return
+		}
+
+		// Locks apply to the account from one IP (see vsdb.RecordFailedLogin),
+		// and are enforced without checking the password.
+		ip := middleware.ClientIP(r)
+		lockedUntil, err := vsdb.LoginLockedUntil(db, user.ID, ip)
+		if err != nil {
+			serverError(w, r, err, "could not log in")
+			return
+		}
+		if lockedUntil != nil {
+			writeLockedOut(w, *lockedUntil)
+			return
+		}
 
 		// Compare password with stored bcrypt hash.
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			lockedUntil, err := vsdb.RecordFailedLogin(db, user.ID, ip, opts.LockoutThreshold, opts.LockoutDuration)
+			if err != nil {
+				serverError(w, r, err, "could not record failed login")
+				return
+			}
+			if lockedUntil != nil {
+				middleware.Logger(r.Context()).Warn("account locked after failed logins", "user_id", user.ID, "ip", ip, "until", *lockedUntil)
+				writeLockedOut(w, *lockedUntil)
+				return
+			}
 			writeError(w, http.StatusUnauthorized, "invalid credentials")
 			return
 		}
 
+		// Suspended accounts can't start new sessions.
+		if user.SuspendedAt != nil {
+			writeError(w, http.StatusForbidden, "account suspended")
+			return
+		}
+
+		if err := vsdb.ResetFailedLogins(db, user.ID, ip); err != nil {
+			serverError(w, r, err, "failed to create session")
+			return
+		}
+
+		// Logging in during an account's deletion grace period keeps it.
+		cancelled, err := vsdb.CancelUserDeletion(db, user.ID)
+		if err != nil {
+			serverError(w, r, err, "failed to create session")
+			return
+		}
+		if cancelled {
+			middleware.Logger(r.Context()).Info("account deletion cancelled", "user_id", user.ID)
+		}
+
 		// Create a server-side session.
-		token, err := vsdb.CreateSession(db, user.ID)
+		token, err := vsdb.CreateSession(db, user.ID, opts.SessionTTL, opts.SessionMaxAge, r.UserAgent(), ip)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to create session")
+			serverError(w, r, err, "failed to create session")
 			return
 		}
 
-		// Set session cookie.
+		// Set session cookie. It lives as long as the session could; the
+		// server decides when it has expired from disuse.
 		http.SetCookie(w, &http.Cookie{
 			Name:     "session",
 			Value:    token,
 			Path:     "/",
 			HttpOnly: true,
 			SameSite: http.SameSiteStrictMode,
-			MaxAge:   604800, // 7 days in seconds
-			Secure:   false,  // TODO: set true in production (HTTPS)
+			MaxAge:   int(opts.SessionMaxAge.Seconds()),
+			Secure:   opts.SecureCookies,
 		})
 
 		// Return user profile (password excluded via json:"-" tag).
 		writeJSON(w, http.StatusOK, user)
 	}
 }
+
+// writeLockedOut tells the client the account is locked until the given time.
+func writeLockedOut(w http.ResponseWriter, until time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+	writeError(w, http.StatusTooManyRequests, "too many failed logins, please try again later")
+}
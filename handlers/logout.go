@@ -5,10 +5,12 @@ import (
 	"net/http"
 
 	vsdb "village-square/db"
+	"village-square/middleware"
 )
 
 // Logout returns a handler that destroys the session and clears the cookie.
-func Logout(db *sql.DB) http.HandlerFunc {
+// secure must match the flag the cookie was set with.
+func Logout(db *sql.DB, secure bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -26,14 +28,7 @@ func Logout(db *sql.DB) http.HandlerFunc {
 		_ = vsdb.DeleteSession(db, cookie.Value)
 
 		// Clear the cookie in the browser.
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session",
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			SameSite: http.SameSiteStrictMode,
-			MaxAge:   -1,
-		})
+		middleware.ClearSessionCookie(w, secure)
 
 		writeJSON(w, http.StatusOK, map[string]string{"message": "logged out"})
 	}
@@ -2,10 +2,19 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	vsdb "village-square/db"
+	"village-square/mailer"
 	"village-square/middleware"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Me returns a handler that responds with the logged-in user's profile.
@@ -18,11 +27,229 @@ func Me(db *sql.DB) http.HandlerFunc {
 		}
 
 		user, err := vsdb.GetUserByID(db, userID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
 		if err != nil {
+			serverError(w, r, err, "could not load profile")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+// Limits on the free-text profile fields. The avatar is meant for an emoji,
+// which can take several code points.
+const (
+	maxBioLength    = 500 // characters
+	maxAvatarLength = 32  // bytes
+)
+
+// updateMeRequest is the JSON body for PATCH /api/me. Omitted fields are left
+// unchanged; changing the email also needs the current password.
+type updateMeRequest struct {
+	Name     *string `json:"name"`
+	Email    *string `json:"email"`
+	Bio      *string `json:"bio"`
+	Avatar   *string `json:"avatar"`
+	Password string  `json:"password"`
+}
+
+// UpdateMe handles PATCH /api/me (auth required). A new email address must be
+// confirmed again: the account becomes unverified and a link is sent to the
+// new address.
+func UpdateMe(db *sql.DB, m mailer.Mailer, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+
+		var req updateMeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		user, err := vsdb.GetUserByID(db, userID)
+		if err == sql.ErrNoRows {
 			writeError(w, http.StatusNotFound, "user not found")
 			return
 		}
+		if err != nil {
+			serverError(w, r, err, "could not load profile")
+			return
+		}
 
+		name, email, bio, avatar := user.Name, user.Email, user.Bio, user.Avatar
+		if req.Name != nil {
+			name = strings.TrimSpace(*req.Name)
+			if name == "" {
+				writeError(w, http.StatusBadRequest, "name is required")
+				return
+			}
+		}
+		if req.Email != nil {
+			email = strings.TrimSpace(*req.Email)
+			if _, err := mail.ParseAddress(email); err != nil || email == "" {
+				writeError(w, http.StatusBadRequest, "valid email is required")
+				return
+			}
+			// The address receives password resets, so taking it over
+			// needs more than a session.
+			if email != user.Email && !checkPassword(w, user, req.Password) {
+				return
+			}
+		}
+
+		if req.Bio != nil {
+			bio = strings.TrimSpace(*req.Bio)
+			if utf8.RuneCountInString(bio) > maxBioLength {
+				writeError(w, http.StatusBadRequest, "bio must be at most 500 characters")
+				return
+			}
+		}
+		if req.Avatar != nil {
+			avatar = strings.TrimSpace(*req.Avatar)
+			if len(avatar) > maxAvatarLength || strings.IndexFunc(avatar, func(r rune) bool {
+				return unicode.IsSpace(r) || unicode.IsControl(r)
+			}) >= 0 {
+				writeError(w, http.StatusBadRequest, "avatar must be an emoji or a few characters")
+				return
+			}
+		}
+
+		changed, err := vsdb.UpdateUserProfile(db, userID, name, email, bio, avatar)
+		if err == vsdb.ErrEmailTaken {
+			writeError(w, http.StatusConflict, "email already registered")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update profile")
+			return
+		}
+		if changed {
+			if err := sendVerificationEmail(db, m, baseURL, userID, name, email); err != nil {
+				middleware.Logger(r.Context()).Error("could not send verification email", "user_id", userID, "error", err)
+			}
+		}
+
+		user, err = vsdb.GetUserByID(db, userID)
+		if err != nil {
+			serverError(w, r, err, "could not load profile")
+			return
+		}
 		writeJSON(w, http.StatusOK, user)
 	}
 }
+
+// ChangePassword handles POST /api/me/password (auth required). It needs the
+// current password, and logs out every other session.
+func ChangePassword(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+		cookie, _ := r.Cookie("session")
+
+		var req struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if len(req.NewPassword) < 6 {
+			writeError(w, http.StatusBadRequest, "password must be at least 6 characters")
+			return
+		}
+
+		user, err := vsdb.GetUserByID(db, userID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not load profile")
+			return
+		}
+		if !checkPassword(w, user, req.CurrentPassword) {
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			serverError(w, r, err, "failed to hash password")
+			return
+		}
+		if err := vsdb.SetUserPassword(db, userID, string(hash), cookie.Value); err != nil {
+			serverError(w, r, err, "could not change password")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"message": "password updated"})
+	}
+}
+
+// DeleteMe handles DELETE /api/me (auth required), confirmed with the
+// password. With a zero grace period the account and everything in it is
+// deleted at once. Otherwise it is logged out and deleted once grace has
+// passed, unless the user logs in again first. secure must match the flag
+// the session cookie was set with.
+func DeleteMe(db *sql.DB, secure bool, grace time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		user, err := vsdb.GetUserByID(db, userID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not load profile")
+			return
+		}
+		if !checkPassword(w, user, req.Password) {
+			return
+		}
+
+		if grace <= 0 {
+			if err := vsdb.DeleteUser(db, userID); err != nil {
+				serverError(w, r, err, "could not delete account")
+				return
+			}
+			middleware.Logger(r.Context()).Info("account deleted", "user_id", userID)
+			middleware.ClearSessionCookie(w, secure)
+			writeJSON(w, http.StatusOK, map[string]string{"message": "account deleted"})
+			return
+		}
+
+		deleteAfter := time.Now().UTC().Add(grace).Truncate(time.Second)
+		if err := vsdb.ScheduleUserDeletion(db, userID, deleteAfter); err != nil {
+			serverError(w, r, err, "could not delete account")
+			return
+		}
+		middleware.Logger(r.Context()).Info("account deletion scheduled", "user_id", userID, "delete_after", deleteAfter)
+		middleware.ClearSessionCookie(w, secure)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"message":      "account will be deleted; log in again before then to keep it",
+			"delete_after": deleteAfter,
+		})
+	}
+}
+
+// checkPassword confirms a sensitive change with the user's password,
+// writing a 403 if it is wrong.
+func checkPassword(w http.ResponseWriter, user *vsdb.User, password string) bool {
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		writeError(w, http.StatusForbidden, "incorrect password")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"village-square/db"
+	"village-square/middleware"
+)
+
+// decodeMessageBody reads and validates the {"body": "..."} of a new message.
+// Returns an error message or "".
+func decodeMessageBody(r *http.Request) (string, string) {
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", "invalid JSON"
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		return "", "message body is required"
+	}
+	if len(body) > 2000 {
+		return "", "message must be under 2000 characters"
+	}
+	return body, ""
+}
+
+// SendPostMessage handles POST /api/posts/{id}/messages (auth required).
+// A villager who has registered interest in a post messages its author;
+// the first message starts their conversation about the post.
+func SendPostMessage(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+		body, msg := decodeMessageBody(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		callerID, _ := middleware.GetUserID(r)
+
+		post, err := db.GetPostByID(database, id, callerID)
+		if err == sql.ErrNoRows || (err == nil && post.Hidden) {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.Type == "announcement" {
+			writeError(w, http.StatusBadRequest, "messages not available for announcements")
+			return
+		}
+		if post.UserID == callerID {
+			writeError(w, http.StatusBadRequest, "reply from your conversations instead")
+			return
+		}
+		if !post.UserInterested {
+			writeError(w, http.StatusForbidden, "register your interest in this post first")
+			return
+		}
+
+		message, err := db.StartConversation(database, id, post.UserID, callerID, body)
+		if err != nil {
+			serverError(w, r, err, "could not send message")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, message)
+	}
+}
+
+// ListConversations handles GET /api/conversations (auth required).
+func ListConversations(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+
+		conversations, err := db.ListConversations(database, userID)
+		if err != nil {
+			serverError(w, r, err, "could not list conversations")
+			return
+		}
+
+		unread := 0
+		for _, c := range conversations {
+			unread += c.Unread
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"conversations": conversations,
+			"count":         len(conversations),
+			"unread":        unread,
+		})
+	}
+}
+
+// UnreadMessages handles GET /api/messages/unread (auth required). It
+// returns how many messages to the caller are unread, for the nav badge.
+func UnreadMessages(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+
+		unread, err := db.CountUnreadMessages(database, userID)
+		if err != nil {
+			serverError(w, r, err, "could not count unread messages")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]int{"unread": unread})
+	}
+}
+
+// GetConversation handles GET /api/conversations/{id} (auth required). It
+// returns the thread and marks the caller's incoming messages as read.
+func GetConversation(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid conversation id")
+			return
+		}
+
+		userID, _ := middleware.GetUserID(r)
+
+		// Check access before touching read state.
+		_, err = db.GetConversation(database, id, userID)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "conversation not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve conversation")
+			return
+		}
+
+		if err := db.MarkConversationRead(database, id, userID); err != nil {
+			serverError(w, r, err, "could not update conversation")
+			return
+		}
+
+		conversation, err := db.GetConversation(database, id, userID)
+		if err != nil {
+			serverError(w, r, err, "could not retrieve conversation")
+			return
+		}
+		messages, err := db.ListMessages(database, id)
+		if err != nil {
+			serverError(w, r, err, "could not list messages")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"conversation": conversation, "messages": messages})
+	}
+}
+
+// ReplyToConversation handles POST /api/conversations/{id}/messages (auth
+// required). Either participant can reply.
+func ReplyToConversation(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid conversation id")
+			return
+		}
+		body, msg := decodeMessageBody(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		userID, _ := middleware.GetUserID(r)
+
+		message, err := db.CreateMessage(database, id, userID, body)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "conversation not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not send message")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, message)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+
+	"village-square/db"
+	"village-square/metrics"
+)
+
+// Gauges refreshed from the database on every scrape.
+var (
+	activeSessions = metrics.NewGauge("vs_sessions_active", "Unexpired login sessions.")
+	postCount      = metrics.NewGauge("vs_posts", "Posts, by status.", "status")
+	eventCount     = metrics.NewGauge("vs_events", "Village Day events.")
+	interestCount  = metrics.NewGauge("vs_interests", "Registered interests in posts.")
+)
+
+// Metrics handles GET /metrics in the Prometheus text format. Scrapers must
+// send "Authorization: Bearer <token>". collectors are written after the
+// database gauges.
+func Metrics(database *sql.DB, token string, collectors ...metrics.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer " + token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		stats, err := db.CountStats(database)
+		if err != nil {
+			serverError(w, r, err, "could not collect metrics")
+			return
+		}
+		activeSessions.Set(float64(stats.ActiveSessions))
+		for status, n := range stats.PostsByStatus {
+			postCount.Set(float64(n), status)
+		}
+		eventCount.Set(float64(stats.Events))
+		interestCount.Set(float64(stats.Interests))
+
+		var buf bytes.Buffer
+		all := append([]metrics.Collector{activeSessions, postCount, eventCount, interestCount}, collectors...)
+		if err := metrics.Write(&buf, all...); err != nil {
+			serverError(w, r, err, "could not collect metrics")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"village-square/db"
+)
+
+// Page size bounds for list endpoints.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// parsePage reads the ?limit= and ?cursor= query parameters. It returns a
+// user-facing error message, or "" if both are valid.
+func parsePage(r *http.Request) (limit int, after *db.Cursor, msg string) {
+	limit, msg = parseLimit(r)
+	if msg != "" {
+		return 0, nil, msg
+	}
+
+	if s := r.URL.Query().Get("cursor"); s != "" {
+		c, err := db.ParseCursor(s)
+		if err != nil {
+			return 0, nil, "invalid cursor"
+		}
+		after = c
+	}
+
+	return limit, after, ""
+}
+
+// parseLimit reads the ?limit= query parameter, for lists without cursors.
+func parseLimit(r *http.Request) (int, string) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return defaultPageSize, ""
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxPageSize {
+		return 0, "limit must be between 1 and " + strconv.Itoa(maxPageSize)
+	}
+	return n, ""
+}
+
+// cursorString renders the next-page cursor for JSON, or nil on the last page.
+func cursorString(c *db.Cursor) *string {
+	if c == nil {
+		return nil
+	}
+	s := c.String()
+	return &s
+}
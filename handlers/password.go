@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	vsdb "village-square/db"
+	"village-square/mailer"
+	"village-square/middleware"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// resetTokenTTL is how long a password-reset link stays valid.
+const resetTokenTTL = time.Hour
+
+// ForgotPassword returns a handler for POST /api/password/forgot. It emails a
+// reset link to the address if it belongs to an account. The response is the
+// same either way, in content and timing, so it can't be used to discover
+// registered emails.
+func ForgotPassword(db *sql.DB, m mailer.Mailer, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		req.Email = strings.TrimSpace(req.Email)
+		if req.Email == "" {
+			writeError(w, http.StatusBadRequest, "email is required")
+			return
+		}
+
+		const sent = "if that email is registered, a reset link has been sent"
+
+		user, err := vsdb.GetUserByEmail(db, req.Email)
+		if err == sql.ErrNoRows {
+			writeJSON(w, http.StatusOK, map[string]string{"message": sent})
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not send reset link")
+			return
+		}
+
+		// The token and email are handled after responding, so a registered
+		// address doesn't answer more slowly than an unknown one. Failures
+		// can only be logged.
+		log := middleware.Logger(r.Context())
+		go sendPasswordReset(db, m, baseURL, user, log)
+
+		writeJSON(w, http.StatusOK, map[string]string{"message": sent})
+	}
+}
+
+// sendPasswordReset issues a reset token for user and emails them the link.
+func sendPasswordReset(db *sql.DB, m mailer.Mailer, baseURL string, user *vsdb.User, log *slog.Logger) {
+	token, err := vsdb.CreatePasswordReset(db, user.ID, resetTokenTTL)
+	if err != nil {
+		log.Error("could not create reset token", "user_id", user.ID, "error", err)
+		return
+	}
+
+	link := baseURL + "/reset-password.html?token=" + url.QueryEscape(token)
+	err = m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Village Square: reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your Village Square password. "+
+			"If it was you, open this link within the hour:\n\n%s\n\n"+
+			"If not, you can ignore this email.\n", user.Name, link),
+	})
+	if err != nil {
+		log.Error("could not send password reset email", "user_id", user.ID, "error", err)
+	}
+}
+
+// ResetPassword returns a handler for POST /api/password/reset. It sets a new
+// password using a token from ForgotPassword and logs the user out everywhere.
+func ResetPassword(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if req.Token == "" {
+			writeError(w, http.StatusBadRequest, "token is required")
+			return
+		}
+		if len(req.Password) < 6 {
+			writeError(w, http.StatusBadRequest, "password must be at least 6 characters")
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			serverError(w, r, err, "failed to hash password")
+			return
+		}
+
+		_, err = vsdb.ResetPassword(db, req.Token, string(hash))
+		if err == vsdb.ErrInvalidToken {
+			writeError(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not reset password")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"message": "password updated"})
+	}
+}
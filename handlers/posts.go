@@ -37,50 +37,24 @@ func CreatePost(database *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Validate title.
-		req.Title = strings.TrimSpace(req.Title)
-		if req.Title == "" {
-			writeError(w, http.StatusBadRequest, "title is required")
-			return
-		}
-		if len(req.Title) > 200 {
-			writeError(w, http.StatusBadRequest, "title must be under 200 characters")
-			return
-		}
-
-		// Validate body.
-		req.Body = strings.TrimSpace(req.Body)
-		if len(req.Body) > 2000 {
-			writeError(w, http.StatusBadRequest, "body must be under 2000 characters")
-			return
-		}
-
-		// Validate / default category.
-		if req.Category == "" {
-			req.Category = "other"
-		}
-		validCats := map[string]bool{"fish": true, "produce": true, "crafts": true, "services": true, "other": true}
-		if !validCats[req.Category] {
-			writeError(w, http.StatusBadRequest, "category must be fish, produce, crafts, services, or other")
+		// Validate title, body and category.
+		if msg := validatePostFields(&req.Title, &req.Body, &req.Category); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
 			return
 		}
 
 		userID, _ := middleware.GetUserID(r)
 
 		// Validate optional event_id.
-		var eventID *int64
-		if req.EventID != 0 {
-			_, err := db.GetEventByID(database, req.EventID)
-			if err != nil {
-				writeError(w, http.StatusBadRequest, "event not found")
-				return
-			}
-			eventID = &req.EventID
+		eventID, msg := resolveEventLink(database, req.EventID)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
 		}
 
 		post, err := db.CreatePost(database, userID, req.Type, req.Title, req.Body, req.Category, eventID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not create post")
+			serverError(w, r, err, "could not create post")
 			return
 		}
 
@@ -92,11 +66,52 @@ func CreatePost(database *sql.DB) http.HandlerFunc {
 var validTypes = map[string]bool{"offer": true, "request": true, "announcement": true}
 var validCategories = map[string]bool{"fish": true, "produce": true, "crafts": true, "services": true, "other": true}
 
-// ListPosts handles GET /api/posts (public).
+// validatePostFields trims title and body, defaults an empty category to
+// "other", and checks all three. It returns a user-facing error message, or
+// "" if the fields are valid.
+func validatePostFields(title, body, category *string) string {
+	*title = strings.TrimSpace(*title)
+	if *title == "" {
+		return "title is required"
+	}
+	if len(*title) > 200 {
+		return "title must be under 200 characters"
+	}
+
+	*body = strings.TrimSpace(*body)
+	if len(*body) > 2000 {
+		return "body must be under 2000 characters"
+	}
+
+	if *category == "" {
+		*category = "other"
+	}
+	if !validCategories[*category] {
+		return "category must be fish, produce, crafts, services, or other"
+	}
+
+	return ""
+}
+
+// resolveEventLink checks that a post's event_id refers to an existing event.
+// An ID of 0 means "no event" and yields nil.
+func resolveEventLink(database *sql.DB, eventID int64) (*int64, string) {
+	if eventID == 0 {
+		return nil, ""
+	}
+	if _, err := db.GetEventByID(database, eventID); err != nil {
+		return nil, "event not found"
+	}
+	return &eventID, ""
+}
+
+// ListPosts handles GET /api/posts (public). Without ?status= only available
+// and reserved posts are listed; ?status=all lists every post.
 func ListPosts(database *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		postType := r.URL.Query().Get("type")
 		category := r.URL.Query().Get("category")
+		status := r.URL.Query().Get("status")
 
 		if postType != "" && !validTypes[postType] {
 			writeError(w, http.StatusBadRequest, "invalid type filter")
@@ -106,6 +121,16 @@ func ListPosts(database *sql.DB) http.HandlerFunc {
 			writeError(w, http.StatusBadRequest, "invalid category filter")
 			return
 		}
+		if status != "" && status != db.StatusAll && !db.ValidPostStatus(status) {
+			writeError(w, http.StatusBadRequest, "invalid status filter")
+			return
+		}
+
+		limit, after, msg := parsePage(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
 
 		var callerUserID int64
 		if cookie, err := r.Cookie("session"); err == nil {
@@ -114,13 +139,26 @@ func ListPosts(database *sql.DB) http.HandlerFunc {
 			}
 		}
 
-		posts, err := db.ListPosts(database, postType, category, callerUserID)
+		filter := db.PostFilter{Type: postType, Category: category, Status: status}
+
+		posts, next, err := db.ListPosts(database, filter, callerUserID, limit, after)
+		if err != nil {
+			serverError(w, r, err, "could not list posts")
+			return
+		}
+
+		total, err := db.CountPosts(database, filter)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not list posts")
+			serverError(w, r, err, "could not count posts")
 			return
 		}
 
-		writeJSON(w, http.StatusOK, map[string]any{"posts": posts, "count": len(posts)})
+		writeJSON(w, http.StatusOK, map[string]any{
+			"posts":       posts,
+			"count":       len(posts),
+			"total":       total,
+			"next_cursor": cursorString(next),
+		})
 	}
 }
 
@@ -147,7 +185,11 @@ func GetPost(database *sql.DB) http.HandlerFunc {
 			return
 		}
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not retrieve post")
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.Hidden && !canSeeHidden(database, callerUserID, post.UserID) {
+			writeError(w, http.StatusNotFound, "post not found")
 			return
 		}
 
@@ -155,6 +197,179 @@ func GetPost(database *sql.DB) http.HandlerFunc {
 	}
 }
 
+// UpdatePost handles PATCH /api/posts/{id} (auth required).
+// Omitted fields keep their current value; "event_id": 0 unlinks the event.
+func UpdatePost(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+
+		var req struct {
+			Title    *string `json:"title"`
+			Body     *string `json:"body"`
+			Category *string `json:"category"`
+			EventID  *int64  `json:"event_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+
+		userID, _ := middleware.GetUserID(r)
+
+		post, err := db.GetPostByID(database, id, userID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.UserID != userID {
+			writeError(w, http.StatusForbidden, "you can only edit your own posts")
+			return
+		}
+
+		// Start from the current values and apply the fields that were sent.
+		title, body, category := post.Title, post.Body, post.Category
+		if req.Title != nil {
+			title = *req.Title
+		}
+		if req.Body != nil {
+			body = *req.Body
+		}
+		if req.Category != nil {
+			category = *req.Category
+		}
+		if msg := validatePostFields(&title, &body, &category); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		eventID := post.EventID
+		if req.EventID != nil {
+			var msg string
+			eventID, msg = resolveEventLink(database, *req.EventID)
+			if msg != "" {
+				writeError(w, http.StatusBadRequest, msg)
+				return
+			}
+		}
+
+		updated, err := db.UpdatePost(database, id, userID, title, body, category, eventID)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update post")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, updated)
+	}
+}
+
+// SetPostStatus handles POST /api/posts/{id}/status (auth required).
+// Authors mark posts available, reserved or completed; expiry is automatic.
+func SetPostStatus(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+
+		var req struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		if req.Status != db.StatusAvailable && req.Status != db.StatusReserved && req.Status != db.StatusCompleted {
+			writeError(w, http.StatusBadRequest, "status must be available, reserved, or completed")
+			return
+		}
+
+		userID, _ := middleware.GetUserID(r)
+
+		post, err := db.GetPostByID(database, id, userID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.UserID != userID {
+			writeError(w, http.StatusForbidden, "you can only change the status of your own posts")
+			return
+		}
+
+		updated, err := db.SetPostStatus(database, id, userID, req.Status)
+		if err == db.ErrInvalidTransition {
+			writeError(w, http.StatusConflict, "cannot change a "+post.Status+" post to "+req.Status)
+			return
+		}
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not update post status")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, updated)
+	}
+}
+
+// ListPostRevisions handles GET /api/posts/{id}/revisions (public).
+func ListPostRevisions(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+
+		var callerUserID int64
+		if cookie, err := r.Cookie("session"); err == nil {
+			if uid, err := db.GetSession(database, cookie.Value); err == nil {
+				callerUserID = uid
+			}
+		}
+
+		post, err := db.GetPostByID(database, id, callerUserID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.Hidden && !canSeeHidden(database, callerUserID, post.UserID) {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+
+		revisions, err := db.ListPostRevisions(database, id)
+		if err != nil {
+			serverError(w, r, err, "could not list revisions")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"revisions": revisions, "count": len(revisions)})
+	}
+}
+
 // DeletePost handles DELETE /api/posts/{id} (auth required).
 func DeletePost(database *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -173,7 +388,7 @@ func DeletePost(database *sql.DB) http.HandlerFunc {
 			return
 		}
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "could not delete post")
+			serverError(w, r, err, "could not delete post")
 			return
 		}
 
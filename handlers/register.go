@@ -8,6 +8,9 @@ import (
 	"strings"
 	"time"
 
+	"village-square/mailer"
+	"village-square/middleware"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -20,15 +23,17 @@ type registerRequest struct {
 
 // registerResponse is returned on successful registration.
 type registerResponse struct {
-	ID        int64  `json:"id"`
-	Name      string `json:"name"`
-	Email     string `json:"email"`
-	Role      string `json:"role"`
-	CreatedAt string `json:"created_at"`
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	Email      string  `json:"email"`
+	Role       string  `json:"role"`
+	CreatedAt  string  `json:"created_at"`
+	VerifiedAt *string `json:"verified_at"` // always null: the address is confirmed by email
 }
 
-// Register returns a handler that creates a new user account.
-func Register(db *sql.DB) http.HandlerFunc {
+// Register returns a handler that creates a new user account and emails a
+// link to verify its address.
+func Register(db *sql.DB, m mailer.Mailer, baseURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Method check (belt-and-suspenders; mux pattern already filters).
 		if r.Method != http.MethodPost {
@@ -64,7 +69,7 @@ func Register(db *sql.DB) http.HandlerFunc {
 		// Hash password.
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to hash password")
+			serverError(w, r, err, "failed to hash password")
 			return
 		}
 
@@ -78,7 +83,7 @@ func Register(db *sql.DB) http.HandlerFunc {
 				writeError(w, http.StatusConflict, "email already registered")
 				return
 			}
-			writeError(w, http.StatusInternalServerError, "failed to create user")
+			serverError(w, r, err, "failed to create user")
 			return
 		}
 
@@ -94,6 +99,11 @@ func Register(db *sql.DB) http.HandlerFunc {
 			createdAt = t.UTC().Format(time.RFC3339)
 		}
 
+		// The account exists either way; a failed email can be resent later.
+		if err := sendVerificationEmail(db, m, baseURL, id, req.Name, req.Email); err != nil {
+			middleware.Logger(r.Context()).Error("could not send verification email", "user_id", id, "error", err)
+		}
+
 		writeJSON(w, http.StatusCreated, registerResponse{
 			ID:        id,
 			Name:      req.Name,
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"village-square/db"
+	"village-square/middleware"
+)
+
+// decodeReportReason reads the {"reason": "..."} body of a report, which is
+// required. Returns an error message or "".
+func decodeReportReason(r *http.Request) (string, string) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", "invalid JSON"
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return "", "reason is required"
+	}
+	if len(reason) > maxReasonLength {
+		return "", "reason must be 500 characters or fewer"
+	}
+	return reason, ""
+}
+
+// ReportPost handles POST /api/posts/{id}/report (auth required). Posts with
+// threshold open reports are hidden until a moderator looks at them.
+func ReportPost(database *sql.DB, threshold int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid post id")
+			return
+		}
+		reason, msg := decodeReportReason(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		callerID, _ := middleware.GetUserID(r)
+
+		post, err := db.GetPostByID(database, id, callerID)
+		if err == sql.ErrNoRows || (err == nil && post.Hidden) {
+			writeError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve post")
+			return
+		}
+		if post.UserID == callerID {
+			writeError(w, http.StatusBadRequest, "cannot report your own post")
+			return
+		}
+
+		err = db.ReportPost(database, id, callerID, reason, threshold)
+		if err == db.ErrAlreadyReported {
+			writeError(w, http.StatusConflict, "you have already reported this post")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not save report")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]string{"message": "report received"})
+	}
+}
+
+// ReportEvent handles POST /api/events/{id}/report (auth required).
+func ReportEvent(database *sql.DB, threshold int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid event id")
+			return
+		}
+		reason, msg := decodeReportReason(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		event, err := db.GetEventByID(database, id)
+		if err == sql.ErrNoRows || (err == nil && event.Hidden) {
+			writeError(w, http.StatusNotFound, "event not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve event")
+			return
+		}
+
+		callerID, _ := middleware.GetUserID(r)
+		if event.UserID == callerID {
+			writeError(w, http.StatusBadRequest, "cannot report your own event")
+			return
+		}
+
+		err = db.ReportEvent(database, id, callerID, reason, threshold)
+		if err == db.ErrAlreadyReported {
+			writeError(w, http.StatusConflict, "you have already reported this event")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not save report")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]string{"message": "report received"})
+	}
+}
+
+// ListReports handles GET /api/admin/reports (admin only): the moderation
+// queue. ?status= picks open (default), dismissed or actioned reports.
+func ListReports(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = db.ReportOpen
+		}
+		if status != db.ReportOpen && status != db.ReportDismissed && status != db.ReportActioned {
+			writeError(w, http.StatusBadRequest, "status must be one of: open, dismissed, actioned")
+			return
+		}
+
+		limit, msg := parseLimit(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		reports, err := db.ListReports(database, status, limit)
+		if err != nil {
+			serverError(w, r, err, "could not list reports")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"reports": reports, "count": len(reports)})
+	}
+}
+
+// ResolveReport handles POST /api/admin/reports/{id}/resolve (admin only).
+// Body: {"resolution": "dismissed"|"actioned", "reason": "..."}. All open
+// reports on the same item are resolved together; "unhidden" in the response
+// says whether dismissing them restored an automatically hidden item.
+func ResolveReport(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid report id")
+			return
+		}
+
+		var req struct {
+			Resolution string `json:"resolution"`
+			Reason     string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if len(req.Reason) > maxReasonLength {
+			writeError(w, http.StatusBadRequest, "reason must be 500 characters or fewer")
+			return
+		}
+
+		adminID, _ := middleware.GetUserID(r)
+		unhidden, err := db.ResolveReport(database, adminID, id, req.Resolution, req.Reason)
+		if err == db.ErrInvalidResolution {
+			writeError(w, http.StatusBadRequest, "resolution must be one of: dismissed, actioned")
+			return
+		}
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "no open report with that id")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not resolve report")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": req.Resolution, "unhidden": unhidden})
+	}
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+
+	"village-square/middleware"
 )
 
 // writeJSON marshals data as JSON and writes it with the given status code.
@@ -16,3 +18,10 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
+
+// serverError logs err with the request's ID and writes a 500 with message.
+// The client only sees message; the details stay in the log.
+func serverError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	middleware.Logger(r.Context()).Error(message, "method", r.Method, "path", r.URL.Path, "error", err)
+	writeError(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"village-square/db"
+)
+
+// Search handles GET /api/search?q=...&limit=... (public).
+func Search(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			writeError(w, http.StatusBadRequest, "q is required")
+			return
+		}
+		if len(q) > 200 {
+			writeError(w, http.StatusBadRequest, "q must be under 200 characters")
+			return
+		}
+
+		limit := 20
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > 50 {
+				writeError(w, http.StatusBadRequest, "limit must be between 1 and 50")
+				return
+			}
+			limit = n
+		}
+
+		var callerUserID int64
+		if cookie, err := r.Cookie("session"); err == nil {
+			if uid, err := db.GetSession(database, cookie.Value); err == nil {
+				callerUserID = uid
+			}
+		}
+
+		results, err := db.Search(database, q, limit, callerUserID)
+		if err == db.ErrSearchUnavailable {
+			writeError(w, http.StatusServiceUnavailable, "search is not enabled on this server")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not search")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"results": results, "count": len(results)})
+	}
+}
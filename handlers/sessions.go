@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"village-square/db"
+	"village-square/middleware"
+)
+
+// ListSessions handles GET /api/sessions (auth required): the caller's
+// active logins, with the one making the request marked current.
+func ListSessions(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+		cookie, _ := r.Cookie("session") // present: RequireAuth checked it
+
+		sessions, err := db.ListSessions(database, userID, cookie.Value)
+		if err != nil {
+			serverError(w, r, err, "could not list sessions")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"sessions": sessions, "count": len(sessions)})
+	}
+}
+
+// RevokeSession handles DELETE /api/sessions/{id} (auth required). Revoking
+// the current session logs the caller out. secure must match the flag the
+// session cookie was set with.
+func RevokeSession(database *sql.DB, secure bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid session id")
+			return
+		}
+
+		userID, _ := middleware.GetUserID(r)
+		cookie, _ := r.Cookie("session")
+
+		current, err := db.RevokeSession(database, userID, id, cookie.Value)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not revoke session")
+			return
+		}
+		if current {
+			middleware.ClearSessionCookie(w, secure)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"id": id, "revoked": true, "current": current})
+	}
+}
+
+// RevokeAllSessions handles DELETE /api/sessions (auth required): log out
+// everywhere, including this browser.
+func RevokeAllSessions(database *sql.DB, secure bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+
+		n, err := db.DeleteUserSessions(database, userID)
+		if err != nil {
+			serverError(w, r, err, "could not revoke sessions")
+			return
+		}
+		middleware.ClearSessionCookie(w, secure)
+
+		writeJSON(w, http.StatusOK, map[string]any{"revoked": n})
+	}
+}
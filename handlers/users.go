@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"village-square/db"
+)
+
+// UserProfile handles GET /api/users/{id} (public): a villager's name, bio,
+// avatar, when they joined and how active they are. The email address is
+// never included.
+func UserProfile(database *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := r.PathValue("id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+
+		profile, err := db.GetPublicProfile(database, id)
+		if err == db.ErrNotFound {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not retrieve profile")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, profile)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	vsdb "village-square/db"
+	"village-square/mailer"
+	"village-square/middleware"
+)
+
+// verifyTokenTTL is how long an email-verification link stays valid.
+const verifyTokenTTL = 48 * time.Hour
+
+// sendVerificationEmail issues a verification token for the user and emails
+// them a link to confirm their address.
+func sendVerificationEmail(db *sql.DB, m mailer.Mailer, baseURL string, userID int64, name, email string) error {
+	token, err := vsdb.CreateEmailVerification(db, userID, verifyTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := baseURL + "/verify.html?token=" + url.QueryEscape(token)
+	return m.Send(mailer.Message{
+		To:      email,
+		Subject: "Village Square: confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to Village Square! Please confirm your email address "+
+			"so you can start posting:\n\n%s\n\nThe link is valid for 48 hours.\n", name, link),
+	})
+}
+
+// VerifyEmail returns a handler for GET /api/verify?token=... that confirms
+// the email address the token was sent to.
+func VerifyEmail(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			writeError(w, http.StatusBadRequest, "token is required")
+			return
+		}
+
+		_, err := vsdb.VerifyEmail(db, token)
+		if err == vsdb.ErrInvalidToken {
+			writeError(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not verify email")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"message": "email verified"})
+	}
+}
+
+// ResendVerification returns a handler for POST /api/verify/resend (auth
+// required) that emails the logged-in user a fresh verification link.
+func ResendVerification(db *sql.DB, m mailer.Mailer, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := middleware.GetUserID(r)
+
+		user, err := vsdb.GetUserByID(db, userID)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		if err != nil {
+			serverError(w, r, err, "could not load profile")
+			return
+		}
+		if user.VerifiedAt != nil {
+			writeError(w, http.StatusBadRequest, "email already verified")
+			return
+		}
+
+		if err := sendVerificationEmail(db, m, baseURL, user.ID, user.Name, user.Email); err != nil {
+			serverError(w, r, err, "could not send verification email")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"message": "verification email sent"})
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Log is a development mailer: instead of sending, it appends each message to
+// the file at Path, or writes it to the standard logger when Path is empty.
+type Log struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Send records msg.
+func (m *Log) Send(msg Message) error {
+	text := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+
+	if m.Path == "" {
+		slog.Info("mail (not sent)", "to", msg.To, "message", text)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open mail log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "--- %s\n%s\n", time.Now().UTC().Format(time.RFC3339), text); err != nil {
+		return fmt.Errorf("write mail log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+// Package mailer sends transactional email such as password-reset links.
+package mailer
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
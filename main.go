@@ -1,26 +1,54 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"village-square/db"
 	"village-square/handlers"
+	"village-square/mailer"
 	"village-square/middleware"
+	"village-square/scheduler"
 )
 
 func main() {
+	// Log JSON lines to stdout; the standard log package goes through it too.
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
 	seedFlag := flag.Bool("seed", false, "Seed the database with demo data and exit")
+	migrateFlag := flag.String("migrate", "", "Run a schema migration command and exit: status, up, or down")
+	adminFlag := flag.String("admin", "", "Grant the admin role to the user with this email and exit")
+
+	cfg := defaultConfig()
+	if err := cfg.loadEnv(); err != nil {
+		fatal("invalid config", err)
+	}
+	cfg.registerFlags(flag.CommandLine)
 	flag.Parse()
+	if err := cfg.validate(); err != nil {
+		fatal("invalid config", err)
+	}
+
+	if *migrateFlag != "" {
+		if err := runMigrate(*migrateFlag, cfg.DBPath); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate %s failed: %v\n", *migrateFlag, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
 	// Initialise the SQLite database (creates the file on first run).
-	database, err := db.Init("village-square.db")
+	database, err := db.Init(cfg.DBPath)
 	if err != nil {
-		log.Fatalf("database init: %v", err)
+		fatal("could not open database", err)
 	}
 	defer database.Close()
 
@@ -32,23 +60,112 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *adminFlag != "" {
+		if err := db.SetUserRoleByEmail(database, *adminFlag, db.RoleAdmin); err != nil {
+			fmt.Fprintf(os.Stderr, "grant admin to %s failed: %v\n", *adminFlag, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is now an admin.\n", *adminFlag)
+		os.Exit(0)
+	}
+
+	// Outgoing mail: SMTP when configured, otherwise logged for development.
+	mail := newMailer(cfg)
+	baseURL := cfg.BaseURL
+
+	// Posts and events are hidden automatically once they collect this many
+	// open reports; 0 turns auto-hiding off.
+	reportThreshold := cfg.ReportThreshold
+
+	sched := newScheduler(database)
+
+	// Rate limits. Login attempts are limited per IP here and per email inside
+	// the handler, and other password checks per user; signup covers
+	// everything that sends email.
+	loginLimiter := middleware.NewLimiter(cfg.RateLogin)
+	signupLimiter := middleware.NewLimiter(cfg.RateSignup)
+	writeLimiter := middleware.NewLimiter(cfg.RateWrite)
+	loginOptions := handlers.LoginOptions{
+		SessionTTL:       cfg.SessionTTL,
+		SessionMaxAge:    cfg.SessionMaxAge,
+		SecureCookies:    cfg.SecureCookies,
+		EmailLimiter:     middleware.NewLimiter(cfg.RateLogin),
+		LockoutThreshold: cfg.LockoutThreshold,
+		LockoutDuration:  cfg.LockoutDuration,
+	}
+	write := func(h http.HandlerFunc) http.HandlerFunc {
+		return middleware.RateLimit(writeLimiter, h)
+	}
+
 	// Register routes.
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /api/health", handlers.Health(database))
-	mux.HandleFunc("/api/register", handlers.Register(database))
-	mux.HandleFunc("/api/login", handlers.Login(database))
-	mux.HandleFunc("/api/logout", handlers.Logout(database))
-	mux.HandleFunc("GET /api/me", middleware.RequireAuth(database, handlers.Me(database)))
-	mux.HandleFunc("POST /api/posts", middleware.RequireAuth(database, handlers.CreatePost(database)))
+	mux.HandleFunc("/api/register", middleware.RateLimit(signupLimiter, handlers.Register(database, mail, baseURL)))
+	mux.HandleFunc("/api/login", middleware.RateLimit(loginLimiter, handlers.Login(database, loginOptions)))
+	mux.HandleFunc("/api/logout", handlers.Logout(database, cfg.SecureCookies))
+	mux.HandleFunc("POST /api/password/forgot", middleware.RateLimit(signupLimiter, handlers.ForgotPassword(database, mail, baseURL)))
+	mux.HandleFunc("POST /api/password/reset", middleware.RateLimit(loginLimiter, handlers.ResetPassword(database)))
+	mux.HandleFunc("GET /api/verify", handlers.VerifyEmail(database))
+	mux.HandleFunc("POST /api/verify/resend", middleware.RateLimit(signupLimiter, middleware.RequireAuth(database, cfg.SecureCookies, handlers.ResendVerification(database, mail, baseURL))))
+	mux.HandleFunc("GET /api/me", middleware.RequireAuth(database, cfg.SecureCookies, handlers.Me(database)))
+	mux.HandleFunc("PATCH /api/me", middleware.RequireAuth(database, cfg.SecureCookies, middleware.RateLimit(loginLimiter, handlers.UpdateMe(database, mail, baseURL))))
+	mux.HandleFunc("DELETE /api/me", middleware.RequireAuth(database, cfg.SecureCookies, middleware.RateLimit(loginLimiter, handlers.DeleteMe(database, cfg.SecureCookies, cfg.DeleteGrace))))
+	mux.HandleFunc("GET /api/me/export", middleware.RequireAuth(database, cfg.SecureCookies, handlers.ExportMe(database)))
+	mux.HandleFunc("POST /api/me/password", middleware.RequireAuth(database, cfg.SecureCookies, middleware.RateLimit(loginLimiter, handlers.ChangePassword(database))))
+	mux.HandleFunc("GET /api/csrf", middleware.RequireAuth(database, cfg.SecureCookies, handlers.CSRFToken()))
+	mux.HandleFunc("GET /api/users/{id}", handlers.UserProfile(database))
+	mux.HandleFunc("GET /api/sessions", middleware.RequireAuth(database, cfg.SecureCookies, handlers.ListSessions(database)))
+	mux.HandleFunc("DELETE /api/sessions", middleware.RequireAuth(database, cfg.SecureCookies, write(handlers.RevokeAllSessions(database, cfg.SecureCookies))))
+	mux.HandleFunc("DELETE /api/sessions/{id}", middleware.RequireAuth(database, cfg.SecureCookies, write(handlers.RevokeSession(database, cfg.SecureCookies))))
+	mux.HandleFunc("POST /api/posts", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.CreatePost(database)))))
 	mux.HandleFunc("GET /api/posts", handlers.ListPosts(database))
 	mux.HandleFunc("GET /api/posts/{id}", handlers.GetPost(database))
-	mux.HandleFunc("DELETE /api/posts/{id}", middleware.RequireAuth(database, handlers.DeletePost(database)))
-	mux.HandleFunc("GET /api/posts/{id}/contact", middleware.RequireAuth(database, handlers.GetPostContact(database)))
-	mux.HandleFunc("POST /api/posts/{id}/interest", middleware.RequireAuth(database, handlers.ToggleInterest(database)))
-	mux.HandleFunc("POST /api/events", middleware.RequireAuth(database, handlers.CreateEvent(database)))
+	mux.HandleFunc("PATCH /api/posts/{id}", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.UpdatePost(database)))))
+	mux.HandleFunc("DELETE /api/posts/{id}", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.DeletePost(database)))))
+	mux.HandleFunc("POST /api/posts/{id}/status", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.SetPostStatus(database)))))
+	mux.HandleFunc("GET /api/posts/{id}/revisions", handlers.ListPostRevisions(database))
+	mux.HandleFunc("POST /api/posts/{id}/interest", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.ToggleInterest(database)))))
+	mux.HandleFunc("GET /api/posts/{id}/interests", middleware.RequireAuth(database, cfg.SecureCookies, handlers.ListPostInterests(database)))
+	mux.HandleFunc("POST /api/posts/{id}/interests/{user_id}/choose", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.ChooseInterest(database, true)))))
+	mux.HandleFunc("DELETE /api/posts/{id}/interests/{user_id}/choose", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.ChooseInterest(database, false)))))
+	mux.HandleFunc("POST /api/posts/{id}/messages", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.SendPostMessage(database)))))
+	mux.HandleFunc("POST /api/posts/{id}/report", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.ReportPost(database, reportThreshold)))))
+	mux.HandleFunc("POST /api/events", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.CreateEvent(database)))))
 	mux.HandleFunc("GET /api/events", handlers.ListEvents(database))
 	mux.HandleFunc("GET /api/events/{id}", handlers.GetEvent(database))
-	mux.HandleFunc("DELETE /api/events/{id}", middleware.RequireAuth(database, handlers.DeleteEvent(database)))
+	mux.HandleFunc("PATCH /api/events/{id}", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.UpdateEvent(database)))))
+	mux.HandleFunc("DELETE /api/events/{id}", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.DeleteEvent(database)))))
+	mux.HandleFunc("GET /api/events/{id}/changes", handlers.ListEventChanges(database))
+	mux.HandleFunc("POST /api/events/{id}/report", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.ReportEvent(database, reportThreshold)))))
+	mux.HandleFunc("GET /api/search", handlers.Search(database))
+	mux.HandleFunc("GET /api/conversations", middleware.RequireAuth(database, cfg.SecureCookies, handlers.ListConversations(database)))
+	mux.HandleFunc("GET /api/messages/unread", middleware.RequireAuth(database, cfg.SecureCookies, handlers.UnreadMessages(database)))
+	mux.HandleFunc("GET /api/conversations/{id}", middleware.RequireAuth(database, cfg.SecureCookies, handlers.GetConversation(database)))
+	mux.HandleFunc("POST /api/conversations/{id}/messages", middleware.RequireAuth(database, cfg.SecureCookies, write(middleware.RequireVerified(database, handlers.ReplyToConversation(database)))))
+
+	// Admin-only moderation endpoints.
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return middleware.RequireAuth(database, cfg.SecureCookies, middleware.RequireRole(database, db.RoleAdmin, h))
+	}
+	mux.HandleFunc("DELETE /api/admin/posts/{id}", admin(handlers.AdminDeletePost(database)))
+	mux.HandleFunc("POST /api/admin/posts/{id}/hide", admin(handlers.AdminHidePost(database, true)))
+	mux.HandleFunc("POST /api/admin/posts/{id}/unhide", admin(handlers.AdminHidePost(database, false)))
+	mux.HandleFunc("DELETE /api/admin/events/{id}", admin(handlers.AdminDeleteEvent(database)))
+	mux.HandleFunc("POST /api/admin/events/{id}/hide", admin(handlers.AdminHideEvent(database, true)))
+	mux.HandleFunc("POST /api/admin/events/{id}/unhide", admin(handlers.AdminHideEvent(database, false)))
+	mux.HandleFunc("POST /api/admin/users/{id}/suspend", admin(handlers.AdminSuspendUser(database, true)))
+	mux.HandleFunc("POST /api/admin/users/{id}/unsuspend", admin(handlers.AdminSuspendUser(database, false)))
+	mux.HandleFunc("POST /api/admin/users/{id}/role", admin(handlers.AdminSetRole(database)))
+	mux.HandleFunc("GET /api/admin/reports", admin(handlers.ListReports(database)))
+	mux.HandleFunc("POST /api/admin/reports/{id}/resolve", admin(handlers.ResolveReport(database)))
+	mux.HandleFunc("GET /api/admin/log", admin(handlers.ModerationLog(database)))
+	mux.HandleFunc("GET /api/admin/jobs", admin(handlers.JobStatus(sched)))
+
+	// Prometheus metrics, only when a scrape token is configured.
+	if cfg.MetricsToken != "" {
+		mux.HandleFunc("GET /metrics", handlers.Metrics(database, cfg.MetricsToken,
+			middleware.HTTPRequests, middleware.HTTPDuration, db.QueryDuration))
+	}
 
 	// Catch-all for unmatched /api/* routes — return JSON errors.
 	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
@@ -57,41 +174,175 @@ func main() {
 		fmt.Fprint(w, `{"error":"not found"}`)
 	})
 
-	// Serve everything in ./static at the root path.
-	fs := http.FileServer(http.Dir("static"))
+	// Serve the frontend at the root path: the embedded static/ tree, or the
+	// -static directory when one is given.
+	static, err := staticHandler(cfg.StaticDir)
+	if err != nil {
+		fatal("could not load static files", err)
+	}
+	mux.Handle("/", static)
+
+	// Start background jobs; their status is shown at /api/admin/jobs.
+	// SIGINT or SIGTERM cancels ctx, which stops the jobs and the server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sched.Start(ctx)
+
+	// Wrap all routes with middleware (outermost → innermost).
+	handler := middleware.RequestID(middleware.Logging(middleware.SecurityHeaders(middleware.LimitBody(cfg.BodyLimit, middleware.Metrics(mux)))))
+	if cfg.TrustProxy {
+		handler = middleware.TrustProxy(handler)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Village Square listening", "addr", cfg.Addr, "base_url", cfg.BaseURL)
+		serveErr <- srv.ListenAndServe()
+	}()
 
-	// Custom handler: serve static files, or 404 page for non-existent paths.
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Let the root "/" pass through to index.html via FileServer.
-		if r.URL.Path == "/" {
-			fs.ServeHTTP(w, r)
-			return
+	select {
+	case err := <-serveErr:
+		// The listener failed before any signal, e.g. the port is taken.
+		stop()
+		sched.Wait()
+		database.Close()
+		fatal("server failed", err)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let in-flight requests finish; the
+	// background jobs were cancelled along with ctx.
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown did not finish cleanly", "error", err)
+	}
+	sched.Wait()
+	slog.Info("stopped")
+}
+
+// postExpiry sets how long posts stay available: fresh fish goes off fast,
+// everything else lasts a month.
+var postExpiry = []db.ExpiryRule{
+	{Type: "offer", Category: "fish", TTL: 2 * 24 * time.Hour},
+	{Type: "offer", Category: "produce", TTL: 7 * 24 * time.Hour},
+	{Type: "offer", TTL: 30 * 24 * time.Hour},
+	{Type: "request", TTL: 30 * 24 * time.Hour},
+	{Type: "announcement", TTL: 30 * 24 * time.Hour},
+}
+
+// newScheduler registers the periodic maintenance jobs.
+func newScheduler(database *sql.DB) *scheduler.Scheduler {
+	sched := scheduler.New()
+	sched.Add("expire-posts", 15*time.Minute, func(ctx context.Context) error {
+		n, err := db.ExpirePosts(ctx, database, postExpiry)
+		if n > 0 {
+			slog.Info("expired posts", "count", n)
 		}
-		// Check if the requested file exists in ./static.
-		path := "static" + r.URL.Path
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			w.WriteHeader(http.StatusNotFound)
-			http.ServeFile(w, r, "static/404.html")
-			return
+		return err
+	})
+	sched.Add("clean-sessions", time.Hour, func(ctx context.Context) error {
+		n, err := db.CleanExpiredSessions(ctx, database)
+		if n > 0 {
+			slog.Info("cleaned expired sessions", "count", n)
 		}
-		fs.ServeHTTP(w, r)
+		return err
 	})
+	sched.Add("delete-accounts", time.Hour, func(ctx context.Context) error {
+		n, err := db.DeleteScheduledUsers(ctx, database)
+		if n > 0 {
+			slog.Info("deleted accounts after grace period", "count", n)
+		}
+		return err
+	})
+	sched.Add("clean-tokens", time.Hour, func(ctx context.Context) error {
+		if _, err := db.CleanExpiredPasswordResets(ctx, database); err != nil {
+			return fmt.Errorf("password resets: %w", err)
+		}
+		if _, err := db.CleanExpiredEmailVerifications(ctx, database); err != nil {
+			return fmt.Errorf("email verifications: %w", err)
+		}
+		if _, err := db.CleanLoginFailures(ctx, database); err != nil {
+			return fmt.Errorf("login failures: %w", err)
+		}
+		return nil
+	})
+	return sched
+}
 
-	// Start background session cleanup goroutine.
-	go func() {
-		for {
-			time.Sleep(1 * time.Hour)
-			n, err := db.CleanExpiredSessions(database)
-			if err != nil {
-				log.Printf("session cleanup error: %v", err)
-			} else if n > 0 {
-				log.Printf("cleaned %d expired sessions", n)
-			}
+// fatal logs err and exits. Deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newMailer returns an SMTP mailer when an SMTP address is configured, and
+// otherwise a development mailer that writes messages to the mail log (or
+// the server log).
+func newMailer(cfg config) mailer.Mailer {
+	if cfg.SMTPAddr != "" {
+		return &mailer.SMTP{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.SMTPFrom,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
 		}
-	}()
+	}
+	return &mailer.Log{Path: cfg.MailLog}
+}
 
-	// Wrap all routes with middleware (outermost → innermost).
-	addr := ":8080"
-	log.Printf("Village Square listening on http://localhost%s\n", addr)
-	log.Fatal(http.ListenAndServe(addr, middleware.Logging(middleware.SecurityHeaders(middleware.LimitBody(mux)))))
+// runMigrate handles the -migrate command-line mode. Unlike a normal start it
+// opens the database without applying migrations, so "status" and "down" see
+// the schema as it is.
+func runMigrate(cmd, dbPath string) error {
+	database, err := db.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch cmd {
+	case "status":
+		states, err := db.MigrationStatus(database)
+		if err != nil {
+			return err
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-28s %s\n", st.Version, st.Name, applied)
+		}
+	case "up":
+		n, err := db.MigrateUp(database)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", n)
+	case "down":
+		st, err := db.MigrateDown(database)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			fmt.Println("no migrations to revert")
+		} else {
+			fmt.Printf("reverted %d %s\n", st.Version, st.Name)
+		}
+	default:
+		return fmt.Errorf("unknown command %q (want status, up, or down)", cmd)
+	}
+	return nil
 }
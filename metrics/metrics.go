@@ -0,0 +1,246 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, from 1 ms to 10 s.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector is a metric that can write itself in the text format.
+type Collector interface {
+	WriteText(w io.Writer) error
+}
+
+// Write writes every collector to w, in order.
+func Write(w io.Writer, collectors ...Collector) error {
+	for _, c := range collectors {
+		if err := c.WriteText(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// family holds what every metric type shares: its name, help text, label
+// names, and a lock over its series. Series are keyed by their label values
+// joined with a NUL byte.
+type family struct {
+	name   string
+	help   string
+	labels []string
+
+	mu sync.Mutex
+}
+
+// key joins label values into a series key. It panics on a label count
+// mismatch, which is a programming error.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+// header writes the HELP and TYPE lines.
+func (f *family) header(w io.Writer, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, typ)
+	return err
+}
+
+// labelString renders label names and values as {a="x",b="y"}, plus any
+// extra pair (used for the histogram "le" label).
+func (f *family) labelString(key string, extra ...string) string {
+	var values []string
+	if len(f.labels) > 0 {
+		values = strings.Split(key, "\x00")
+	}
+	names := f.labels
+	if len(extra) == 2 {
+		names = append(names[:len(names):len(names)], extra[0])
+		values = append(values, extra[1])
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Counter is a monotonically increasing count, split by labels.
+type Counter struct {
+	family
+	values map[string]float64
+}
+
+// NewCounter returns a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{family: family{name: name, help: help, labels: labels}, values: map[string]float64{}}
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	c.values[k]++
+	c.mu.Unlock()
+}
+
+// WriteText implements Collector.
+func (c *Counter) WriteText(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.header(w, "counter"); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(c.values) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(k), formatFloat(c.values[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gauge is a value that can go up and down, split by labels.
+type Gauge struct {
+	family
+	values map[string]float64
+}
+
+// NewGauge returns a gauge with the given label names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{family: family{name: name, help: help, labels: labels}, values: map[string]float64{}}
+}
+
+// Set sets the series with the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	g.values[k] = v
+	g.mu.Unlock()
+}
+
+// WriteText implements Collector.
+func (g *Gauge) WriteText(w io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.header(w, "gauge"); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(g.values) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(k), formatFloat(g.values[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Histogram counts observations into buckets, split by labels.
+type Histogram struct {
+	family
+	buckets []float64 // upper bounds, ascending; +Inf is implied
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram returns a histogram with the given bucket upper bounds and
+// label names.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{
+		family:  family{name: name, help: help, labels: labels},
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v) // first bucket with bound >= v
+	h.mu.Lock()
+	s := h.series[k]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[k] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	h.mu.Unlock()
+}
+
+// WriteText implements Collector.
+func (h *Histogram) WriteText(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.header(w, "histogram"); err != nil {
+		return err
+	}
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, n := range s.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatFloat(h.buckets[i])
+			}
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(k, "le", le), cumulative); err != nil {
+				return err
+			}
+		}
+		labels := h.labelString(k)
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", h.name, labels, formatFloat(s.sum), h.name, labels, s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -16,7 +16,9 @@ type contextKey string
 const UserIDKey contextKey = "userID"
 
 // RequireAuth wraps a handler and ensures the request has a valid session cookie.
-func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+// Requests that change state must also pass the CSRF checks (see checkCSRF).
+// secure must match the flag the session cookie was set with.
+func RequireAuth(db *sql.DB, secure bool, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("session")
 		if err != nil {
@@ -25,19 +27,32 @@ func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		userID, err := vsdb.GetSession(db, cookie.Value)
-		if err != nil {
+		if err == sql.ErrNoRows {
 			// Clear the stale/invalid cookie.
-			http.SetCookie(w, &http.Cookie{
-				Name:     "session",
-				Value:    "",
-				Path:     "/",
-				HttpOnly: true,
-				SameSite: http.SameSiteStrictMode,
-				MaxAge:   -1,
-			})
+			ClearSessionCookie(w, secure)
 			writeAuthError(w, http.StatusUnauthorized, "session expired")
 			return
 		}
+		if err != nil {
+			// Keep the cookie: the session may well be fine once the
+			// database is back.
+			Logger(r.Context()).Error("could not check session", "error", err)
+			writeAuthError(w, http.StatusInternalServerError, "could not check session")
+			return
+		}
+
+		if !safeMethod(r.Method) {
+			if code, message := checkCSRF(r, cookie.Value); code != "" {
+				writeAuthErrorCode(w, http.StatusForbidden, code, message)
+				return
+			}
+		}
+
+		// Keep the session list's last-seen time current; failing that
+		// shouldn't fail the request.
+		if err := vsdb.TouchSession(db, cookie.Value, ClientIP(r)); err != nil {
+			Logger(r.Context()).Warn("could not update session", "user_id", userID, "error", err)
+		}
 
 		// Store user ID in context and call the next handler.
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
@@ -45,6 +60,20 @@ func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// ClearSessionCookie tells the browser to drop its session cookie. secure must
+// match the flag the cookie was set with.
+func ClearSessionCookie(w http.ResponseWriter, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   -1,
+		Secure:   secure,
+	})
+}
+
 // GetUserID extracts the authenticated user ID from the request context.
 // Returns 0, false if not present.
 func GetUserID(r *http.Request) (int64, bool) {
@@ -58,3 +87,11 @@ func writeAuthError(w http.ResponseWriter, status int, message string) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
+
+// writeAuthErrorCode writes a JSON error with a machine-readable code, for
+// failures the frontend needs to tell apart: {"error":"...","code":"..."}.
+func writeAuthErrorCode(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "code": code})
+}
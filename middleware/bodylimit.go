@@ -2,10 +2,10 @@ package middleware
 
 import "net/http"
 
-// LimitBody restricts the request body to 1 MB to prevent abuse.
-func LimitBody(next http.Handler) http.Handler {
+// LimitBody restricts the request body to limit bytes to prevent abuse.
+func LimitBody(limit int64, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1 MB
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFToken(t *testing.T) {
+	a, b := CSRFToken("session-a"), CSRFToken("session-b")
+	if a != CSRFToken("session-a") {
+		t.Error("CSRFToken is not stable for one session")
+	}
+	if a == b {
+		t.Error("two sessions share a CSRF token")
+	}
+	if a == "session-a" {
+		t.Error("CSRF token equals the session token")
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	const session = "session-token"
+	valid := CSRFToken(session)
+
+	tests := []struct {
+		name       string
+		host       string
+		headers    map[string]string
+		trustProxy bool
+		wantCode   string
+	}{
+		{"valid token", "village.nl", map[string]string{CSRFHeader: valid}, false, ""},
+		{"same-origin fetch", "village.nl", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "https://village.nl", CSRFHeader: valid}, false, ""},
+		{"cross-site fetch", "village.nl", map[string]string{"Sec-Fetch-Site": "cross-site", CSRFHeader: valid}, false, "csrf_origin"},
+		{"same-site fetch", "village.nl", map[string]string{"Sec-Fetch-Site": "same-site", CSRFHeader: valid}, false, "csrf_origin"},
+		{"foreign origin", "village.nl", map[string]string{"Origin": "https://evil.example", CSRFHeader: valid}, false, "csrf_origin"},
+		{"origin with other port", "village.nl", map[string]string{"Origin": "https://village.nl:8443", CSRFHeader: valid}, false, "csrf_origin"},
+		{"missing token", "village.nl", nil, false, "csrf_token"},
+		{"invalid token", "village.nl", map[string]string{CSRFHeader: CSRFToken("other-session")}, false, "csrf_token"},
+		{"proxy rewrote host", "127.0.0.1:8080", map[string]string{"Origin": "https://village.nl", CSRFHeader: valid}, false, "csrf_origin"},
+		{"forwarded host trusted", "127.0.0.1:8080", map[string]string{"Origin": "https://village.nl", "X-Forwarded-Host": "village.nl", CSRFHeader: valid}, true, ""},
+		{"forwarded host untrusted", "127.0.0.1:8080", map[string]string{"Origin": "https://village.nl", "X-Forwarded-Host": "village.nl", CSRFHeader: valid}, false, "csrf_origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/posts", nil)
+			r.Host = tt.host
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			var code string
+			check := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				code, _ = checkCSRF(r, session)
+			})
+			if tt.trustProxy {
+				TrustProxy(check).ServeHTTP(httptest.NewRecorder(), r)
+			} else {
+				check(httptest.NewRecorder(), r)
+			}
+
+			if code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSafeMethod(t *testing.T) {
+	for method, want := range map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodPost:    false,
+		http.MethodPatch:   false,
+		http.MethodDelete:  false,
+	} {
+		if got := safeMethod(method); got != want {
+			t.Errorf("safeMethod(%s) = %v, want %v", method, got, want)
+		}
+	}
+}
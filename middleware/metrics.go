@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"village-square/metrics"
+)
+
+// HTTPRequests and HTTPDuration are recorded by Metrics.
+var (
+	HTTPRequests = metrics.NewCounter(
+		"vs_http_requests_total",
+		"HTTP requests served, by route pattern and status code.",
+		"method", "route", "status",
+	)
+	HTTPDuration = metrics.NewHistogram(
+		"vs_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route pattern.",
+		metrics.DefaultBuckets, "method", "route",
+	)
+)
+
+// Metrics counts and times each request. Requests are labelled with the
+// ServeMux pattern that handled them (e.g. "GET /api/posts/{id}") rather
+// than the raw path, which keeps the number of series bounded, so it must
+// wrap the mux with nothing in between that copies the request.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := &statusWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(ww, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		method := methodLabel(r.Method)
+		HTTPRequests.Inc(method, route, strconv.Itoa(ww.status))
+		HTTPDuration.Observe(time.Since(start).Seconds(), method, route)
+	})
+}
+
+// methodLabel maps the client-supplied method onto a fixed set so that
+// arbitrary methods cannot create new series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
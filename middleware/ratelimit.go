@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests requests per Per, in bursts of up to Requests.
+// The zero Limit means no limit.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit parses "N/duration", e.g. "10/1m" or "5/h", or "off".
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+	n, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q (want e.g. 10/1m)", s)
+	}
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q (want e.g. 10/1m)", s)
+	}
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per // "m" means "1m"
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q (want e.g. 10/1m)", s)
+	}
+	return Limit{Requests: requests, Per: d}, nil
+}
+
+// String formats the limit for ParseLimit.
+func (l Limit) String() string {
+	if l.Requests == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// Set implements flag.Value.
+func (l *Limit) Set(s string) error {
+	parsed, err := ParseLimit(s)
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// Limiter is a set of token buckets, one per key (a client IP, an email
+// address, ...), all sharing one Limit.
+type Limiter struct {
+	limit Limit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter for l. A zero l, like a nil *Limiter, allows
+// everything.
+func NewLimiter(l Limit) *Limiter {
+	return &Limiter{limit: l, buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+// Allow takes a token from key's bucket. If the bucket is empty it returns
+// false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.limit.Requests == 0 {
+		return true, 0
+	}
+	now := time.Now()
+	rate := float64(l.limit.Requests) / l.limit.Per.Seconds() // tokens per second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(l.limit.Requests), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.limit.Requests), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely, since they behave the
+// same as a missing one. It runs at most once per Per.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.limit.Per {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.limit.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimit rejects requests with 429 once the client has used up its
+// tokens in l. Clients are told apart by user ID behind RequireAuth, and by
+// IP address otherwise.
+func RateLimit(l *Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + ClientIP(r)
+		if userID, ok := GetUserID(r); ok {
+			key = "user:" + strconv.FormatInt(userID, 10)
+		}
+		if ok, wait := l.Allow(key); !ok {
+			WriteRateLimited(w, wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// WriteRateLimited writes a 429 JSON error with a Retry-After header.
+func WriteRateLimited(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeAuthError(w, http.StatusTooManyRequests, "too many requests, please try again later")
+}
+
+// ClientIP returns the IP address of the client that sent r, from its
+// RemoteAddr (see TrustProxy).
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// TrustProxy replaces RemoteAddr with the client address a reverse proxy
+// appended to X-Forwarded-For, and Host with the one it passed in
+// X-Forwarded-Host, since proxies often rewrite Host to the backend's
+// address and the CSRF origin check compares against it. Only use it behind
+// a proxy that sets these headers, or clients can pick their own address.
+func TrustProxy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			hops := strings.Split(fwd, ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			}
+		}
+		if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+			hops := strings.Split(fwd, ",")
+			if host := strings.TrimSpace(hops[len(hops)-1]); host != "" {
+				r.Host = host
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
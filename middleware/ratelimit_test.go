@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/1m", Limit{10, time.Minute}, false},
+		{"5/h", Limit{5, time.Hour}, false},
+		{"3/30s", Limit{3, 30 * time.Second}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"10", Limit{}, true},
+		{"ten/1m", Limit{}, true},
+		{"-1/1m", Limit{}, true},
+		{"10/0s", Limit{}, true},
+		{"10/soon", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *Limiter
+		calls   int
+		allowed int
+	}{
+		{"nil limiter", nil, 5, 5},
+		{"zero limit", NewLimiter(Limit{}), 5, 5},
+		{"burst then refuse", NewLimiter(Limit{3, time.Hour}), 5, 3},
+		{"single request", NewLimiter(Limit{1, time.Hour}), 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := 0
+			for i := 0; i < tt.calls; i++ {
+				ok, wait := tt.limiter.Allow("ip:10.0.0.1")
+				if ok {
+					allowed++
+					continue
+				}
+				if wait <= 0 || wait > time.Hour {
+					t.Errorf("call %d: wait = %v, want within (0, 1h]", i, wait)
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d of %d, want %d", allowed, tt.calls, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAreSeparate(t *testing.T) {
+	l := NewLimiter(Limit{1, time.Hour})
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request for a refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("second request for a allowed")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("b refused because of a's requests")
+	}
+}
+
+func TestLimiterRefills(t *testing.T) {
+	l := NewLimiter(Limit{1, 20 * time.Millisecond})
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request refused")
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("second request allowed before refill")
+	}
+	time.Sleep(wait + 5*time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("request refused after waiting Retry-After")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := RateLimit(NewLimiter(Limit{1, time.Hour}), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		remoteAddr string
+		wantStatus int
+	}{
+		{"10.0.0.1:1234", http.StatusNoContent},
+		{"10.0.0.1:5678", http.StatusTooManyRequests},
+		{"10.0.0.2:1234", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		r.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.remoteAddr, w.Code, tt.wantStatus)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: 429 without Retry-After", tt.remoteAddr)
+		}
+	}
+}
+
+func TestTrustProxyClientIP(t *testing.T) {
+	tests := []struct {
+		forwardedFor string
+		want         string
+	}{
+		{"", "192.0.2.1"},
+		{"203.0.113.7", "203.0.113.7"},
+		{"198.51.100.9, 203.0.113.7", "203.0.113.7"},
+		{"not-an-ip", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		var got string
+		TrustProxy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = ClientIP(r)
+		})).ServeHTTP(httptest.NewRecorder(), r)
+		if got != tt.want {
+			t.Errorf("X-Forwarded-For %q: ClientIP = %q, want %q", tt.forwardedFor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDKey is the context key for the request ID.
+const RequestIDKey contextKey = "requestID"
+
+// loggerKey is the context key for the request-scoped logger.
+const loggerKey contextKey = "logger"
+
+// RequestID gives every request an ID, taken from a well-formed incoming
+// X-Request-ID header (e.g. set by a proxy) or generated otherwise. The ID is
+// echoed in the response header and attached to the request's logger, which
+// handlers get with Logger.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), RequestIDKey, id)
+		ctx = context.WithValue(ctx, loggerKey, slog.Default().With("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetRequestID returns the request's ID, or "" outside RequestID.
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// Logger returns the logger for the request in ctx, tagged with its request
+// ID, or the default logger outside RequestID.
+func Logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// validRequestID accepts IDs of up to 64 letters, digits, '-', '_' and '.',
+// so a client can't inject arbitrary text into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random hex characters.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
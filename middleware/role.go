@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+
+	vsdb "village-square/db"
+)
+
+// RequireRole wraps a handler (already behind RequireAuth) and only lets
+// through users holding the given role, e.g. RequireRole(db, "admin", h).
+func RequireRole(db *sql.DB, role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := GetUserID(r)
+
+		userRole, err := vsdb.GetUserRole(db, userID)
+		if err != nil {
+			Logger(r.Context()).Error("could not check account role", "user_id", userID, "error", err)
+			writeAuthError(w, http.StatusInternalServerError, "could not check account role")
+			return
+		}
+		if userRole != role {
+			writeAuthError(w, http.StatusForbidden, "insufficient permissions")
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+
+	vsdb "village-square/db"
+)
+
+// RequireVerified wraps a handler (already behind RequireAuth) and rejects
+// users who haven't confirmed their email address.
+func RequireVerified(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := GetUserID(r)
+
+		verified, err := vsdb.IsUserVerified(db, userID)
+		if err != nil {
+			Logger(r.Context()).Error("could not check account status", "user_id", userID, "error", err)
+			writeAuthError(w, http.StatusInternalServerError, "could not check account status")
+			return
+		}
+		if !verified {
+			writeAuthErrorCode(w, http.StatusForbidden, "email_unverified", "please verify your email address first")
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,152 @@
+// Package scheduler runs named background jobs at fixed intervals and keeps
+// track of how each one last went.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Job is one unit of periodic work. ctx is cancelled on shutdown and the
+// job should return promptly once it is.
+type Job func(ctx context.Context) error
+
+// Status describes a registered job and its most recent run.
+type Status struct {
+	Name         string     `json:"name"`
+	Interval     string     `json:"interval"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"last_run"`      // start of the most recent run; nil before the first
+	LastDuration string     `json:"last_duration"` // empty before the first run
+	LastError    string     `json:"last_error"`    // empty if the last run succeeded
+	NextRun      *time.Time `json:"next_run"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+}
+
+// job is a registered Job plus its status, guarded by Scheduler.mu.
+type job struct {
+	fn       Job
+	interval time.Duration
+	status   Status
+}
+
+// Scheduler runs registered jobs until its context is cancelled.
+// Register every job with Add before calling Start.
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs []*job
+	wg   sync.WaitGroup
+}
+
+// New returns an empty Scheduler.
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers fn to run every interval under the given name.
+func (s *Scheduler) Add(name string, interval time.Duration, fn Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{
+		fn:       fn,
+		interval: interval,
+		status:   Status{Name: name, Interval: interval.String()},
+	})
+}
+
+// Start runs each job once right away and then every interval, each in its
+// own goroutine, until ctx is cancelled. It returns immediately; use Wait to
+// block until the jobs have stopped.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+}
+
+// Wait blocks until every job goroutine has returned after cancellation,
+// including any run that was in progress when the context was cancelled.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Status returns a snapshot of every job, in registration order.
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, len(s.jobs))
+	for i, j := range s.jobs {
+		out[i] = j.status
+	}
+	return out
+}
+
+// loop runs one job on its interval until ctx is done.
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		s.run(ctx, j)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes the job once and records the outcome. A panic counts as a
+// failure rather than taking down the process.
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	start := time.Now()
+	s.mu.Lock()
+	j.status.Running = true
+	j.status.LastRun = &start
+	s.mu.Unlock()
+
+	err := call(ctx, j.fn)
+
+	elapsed := time.Since(start)
+	next := start.Add(j.interval)
+	s.mu.Lock()
+	j.status.Running = false
+	j.status.LastDuration = elapsed.String()
+	j.status.NextRun = &next
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+	name := j.status.Name
+	s.mu.Unlock()
+
+	if err != nil {
+		slog.Error("job failed", "job", name, "duration", elapsed.String(), "error", err)
+	}
+}
+
+// call runs fn, turning a panic into an error. The stack is logged since the
+// error alone doesn't say where it happened.
+func call(ctx context.Context, fn Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("job panicked", "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// staticFiles is the static/ tree, built into the binary so the server does
+// not depend on its working directory.
+//
+//go:embed static
+var staticFiles embed.FS
+
+// sharedAssets are referenced from every page. Pages link them with a
+// ?v=<hash> query so browsers can cache them for good and still pick up new
+// versions after a deploy.
+var sharedAssets = []string{"shared.css", "shared.js"}
+
+// asset is one embedded file, prepared once at startup.
+type asset struct {
+	name        string // path inside static/, e.g. "shared.css"
+	contentType string
+	etag        string // strong ETag, quoted
+	hash        string // content hash used in ?v= links
+	raw         []byte
+	gzip        []byte // nil when compressing doesn't help
+	brotli      []byte
+}
+
+// staticHandler serves the embedded files, or the files in dir when dir is
+// set (for working on the frontend without rebuilding). Unknown paths get
+// 404.html with a 404 status.
+func staticHandler(dir string) (http.Handler, error) {
+	if dir != "" {
+		return diskHandler(dir), nil
+	}
+	root, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, err
+	}
+	assets, err := loadAssets(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		a, ok := assets[name]
+		if !ok {
+			serveAsset(w, r, assets["404.html"], http.StatusNotFound)
+			return
+		}
+		switch {
+		case a.hash != "" && r.URL.Query().Get("v") == a.hash:
+			// Versioned link: the content at this URL never changes.
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		case a.hash != "":
+			w.Header().Set("Cache-Control", "public, max-age=300")
+		default:
+			// Pages always revalidate so they pick up new asset links.
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		serveAsset(w, r, a, http.StatusOK)
+	}), nil
+}
+
+// loadAssets reads every file in root, links pages to the current shared
+// assets and precompresses whatever gets smaller.
+func loadAssets(root fs.FS) (map[string]*asset, error) {
+	assets := map[string]*asset{}
+	err := fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		raw, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(raw)
+		}
+		assets[name] = &asset{name: name, contentType: contentType, raw: raw}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the shared assets first so the pages can link to them.
+	var links []string
+	for _, name := range sharedAssets {
+		a, ok := assets[name]
+		if !ok {
+			continue
+		}
+		sum := sha256.Sum256(a.raw)
+		a.hash = hex.EncodeToString(sum[:])[:12]
+		links = append(links, `"/`+name+`"`, `"/`+name+`?v=`+a.hash+`"`)
+	}
+	versioned := strings.NewReplacer(links...)
+
+	for _, a := range assets {
+		if path.Ext(a.name) == ".html" {
+			a.raw = []byte(versioned.Replace(string(a.raw)))
+		}
+		sum := sha256.Sum256(a.raw)
+		a.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		if compressible(a.contentType) {
+			a.gzip = gzipBytes(a.raw)
+			a.brotli = brotliBytes(a.raw)
+		}
+	}
+	if _, ok := assets["404.html"]; !ok {
+		return nil, fmt.Errorf("404.html: %w", fs.ErrNotExist)
+	}
+	return assets, nil
+}
+
+// serveAsset writes a with the best encoding the client accepts. Conditional
+// requests are answered by http.ServeContent using the ETag.
+func serveAsset(w http.ResponseWriter, r *http.Request, a *asset, status int) {
+	body, encoding := a.raw, ""
+	accept := r.Header.Get("Accept-Encoding")
+	switch {
+	case a.brotli != nil && acceptsEncoding(accept, "br"):
+		body, encoding = a.brotli, "br"
+	case a.gzip != nil && acceptsEncoding(accept, "gzip"):
+		body, encoding = a.gzip, "gzip"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", a.contentType)
+	if a.gzip != nil || a.brotli != nil {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+	}
+
+	if status != http.StatusOK {
+		// ServeContent only writes 200s; the 404 page is sent as is.
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+		return
+	}
+
+	// Each encoding is a different representation, so it gets its own tag.
+	etag := a.etag
+	if encoding != "" {
+		etag = strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+	}
+	h.Set("ETag", etag)
+	http.ServeContent(w, r, a.name, time.Time{}, bytes.NewReader(body))
+}
+
+// diskHandler serves dir straight from disk with caching turned off, so
+// edits show up on the next reload.
+func diskHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.URL.Path != "/" {
+			name := filepath.Join(dir, filepath.FromSlash(r.URL.Path))
+			if _, err := os.Stat(name); os.IsNotExist(err) {
+				w.WriteHeader(http.StatusNotFound)
+				http.ServeFile(w, r, filepath.Join(dir, "404.html"))
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// compressible reports whether a content type is text that is worth
+// compressing.
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.HasPrefix(contentType, "application/javascript") ||
+		strings.HasPrefix(contentType, "application/json") ||
+		strings.HasPrefix(contentType, "image/svg+xml")
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding,
+// ignoring any that are explicitly refused with q=0.
+func acceptsEncoding(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), coding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// gzipBytes returns b gzipped at the best compression, or nil if that isn't
+// smaller.
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(b)
+	zw.Close()
+	if buf.Len() >= len(b) {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// brotliBytes returns b brotli-compressed at the best compression, or nil if
+// that isn't smaller.
+func brotliBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	bw.Write(b)
+	bw.Close()
+	if buf.Len() >= len(b) {
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -1,4 +1,61 @@
 /* shared.js — Village Square common utilities */
+
+/* ---- CSRF token ----
+   Signed-in API requests that change something must carry the session's
+   CSRF token. Every page loads this file first, so wrapping fetch here adds
+   the header to all of them: the token is fetched once, sent as
+   X-CSRF-Token, and refreshed once if the server rejects it (e.g. after
+   logging in again in another tab). */
+(function () {
+  var nativeFetch = window.fetch.bind(window);
+  var tokenPromise = null;
+
+  function csrfToken() {
+    if (!tokenPromise) {
+      tokenPromise = nativeFetch('/api/csrf', { credentials: 'same-origin' })
+        .then(function (r) { return r.ok ? r.json() : {}; })
+        .then(function (d) { return d.token || ''; })
+        .catch(function () { return ''; });
+    }
+    return tokenPromise;
+  }
+
+  function withToken(init, token) {
+    var headers = new Headers(init.headers || {});
+    if (token) headers.set('X-CSRF-Token', token);
+    return Object.assign({}, init, { headers: headers });
+  }
+
+  window.fetch = function (input, init) {
+    init = init || {};
+    var url = typeof input === 'string' ? input : input.url;
+    var method = (init.method || 'GET').toUpperCase();
+    var path = new URL(url, window.location.href).pathname;
+
+    // Logging in or out starts a new session with a different token.
+    if (path === '/api/login' || path === '/api/logout') {
+      tokenPromise = null;
+      return nativeFetch(input, init);
+    }
+    if (method === 'GET' || method === 'HEAD' || path.indexOf('/api/') !== 0) {
+      return nativeFetch(input, init);
+    }
+
+    return csrfToken().then(function (token) {
+      return nativeFetch(input, withToken(init, token)).then(function (r) {
+        if (r.status !== 403) return r;
+        return r.clone().json().then(function (d) {
+          if (d.code !== 'csrf_token') return r;
+          tokenPromise = null;
+          return csrfToken().then(function (fresh) {
+            return nativeFetch(input, withToken(init, fresh));
+          });
+        }, function () { return r; });
+      });
+    });
+  };
+})();
+
 var VS = (function () {
   var MAX_TOASTS = 3;
 
@@ -48,10 +105,49 @@ var VS = (function () {
           if (!r.ok) { window.location.href = '/index.html'; return null; }
           return r.json();
         })
-        .then(function (user) { if (user) onSuccess(user); })
+        .then(function (user) {
+          if (!user) return;
+          onSuccess(user);
+          if (!user.verified_at) VS.verifyReminder();
+          VS.updateUnreadBadge();
+        })
         .catch(function () { window.location.href = '/index.html'; });
     },
 
+    /* ---- Unverified-email reminder with a resend link ---- */
+    verifyReminder: function () {
+      var container = document.getElementById('toastContainer');
+      if (!container) return;
+      VS.toast('Please confirm your email address to start posting — check your inbox.', 'info');
+      var el = container.firstChild;
+      var btn = document.createElement('button');
+      btn.type = 'button';
+      btn.className = 'toast-close';
+      btn.textContent = 'Resend';
+      btn.addEventListener('click', function () {
+        btn.disabled = true;
+        fetch('/api/verify/resend', { method: 'POST', credentials: 'same-origin' })
+          .then(function (r) { return r.json().then(function (d) { return { ok: r.ok, data: d }; }); })
+          .then(function (res) {
+            VS.toast(res.ok ? 'Confirmation email sent.' : (res.data.error || 'Could not resend.'), res.ok ? 'success' : 'error');
+          })
+          .catch(function () { VS.toast('Network error. Please try again.', 'error'); });
+      });
+      el.insertBefore(btn, el.querySelector('.toast-close'));
+    },
+
+    /* ---- Unread message count in the nav ---- */
+    updateUnreadBadge: function () {
+      var badge = document.getElementById('unreadBadge');
+      if (!badge) return;
+      fetch('/api/messages/unread', { credentials: 'same-origin' })
+        .then(function (r) { return r.ok ? r.json() : null; })
+        .then(function (data) {
+          if (data) badge.textContent = data.unread > 0 ? String(data.unread) : '';
+        })
+        .catch(function () {});
+    },
+
     /* ---- Logout ---- */
     setupLogout: function () {
       var btn = document.getElementById('logoutBtn');
@@ -67,6 +163,13 @@ var VS = (function () {
       });
     },
 
+    /* ---- Author name linking to their profile, with their avatar ---- */
+    authorLink: function (userID, name, avatar) {
+      return '<a class="author-link" href="/profile.html?id=' + encodeURIComponent(userID) + '">' +
+        (avatar ? '<span class="author-avatar">' + VS.escapeHTML(avatar) + '</span>' : '') +
+        VS.escapeHTML(name) + '</a>';
+    },
+
     /* ---- Time helpers ---- */
     timeAgo: function (dateStr) {
       var secs = Math.floor((Date.now() - new Date(dateStr).getTime()) / 1000);
@@ -141,6 +244,35 @@ var VS = (function () {
       return html;
     },
 
+    /* ---- Cursor-paginated lists ---- */
+    // Adds the next-page cursor from a list response to its URL.
+    pageURL: function (url, cursor) {
+      if (!cursor) return url;
+      return url + (url.indexOf('?') < 0 ? '?' : '&') + 'cursor=' + encodeURIComponent(cursor);
+    },
+
+    // Follows next_cursor until the last page and resolves with every item
+    // under key (e.g. 'events'). For short lists such as dropdowns.
+    fetchAllPages: function (url, key) {
+      var items = [];
+      var next = function (cursor) {
+        return fetch(VS.pageURL(url, cursor))
+          .then(function (r) {
+            if (!r.ok) throw new Error('fetch failed');
+            return r.json();
+          })
+          .then(function (data) {
+            items = items.concat(data[key] || []);
+            return data.next_cursor ? next(data.next_cursor) : items;
+          });
+      };
+      return next(null);
+    },
+
+    loadMoreButton: function (id) {
+      return '<button type="button" class="load-more" id="' + id + '">Load more</button>';
+    },
+
     /* ---- Wire up input listeners to clear field errors ---- */
     clearErrorOnInput: function (inputEl, errorEl) {
       var handler = function () {